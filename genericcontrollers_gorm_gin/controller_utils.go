@@ -1,5 +1,325 @@
 package genericcontrollers_gorm_gin
 
-import "github.com/go-playground/validator/v10"
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	genericcrud_repositories_gorm "github.com/danielcomboni/generic-crud/genericcrud_repositories"
+	"github.com/danielcomboni/generic-crud/logging"
+	"github.com/danielcomboni/generic-crud/responses"
+	"github.com/danielcomboni/generic-crud/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
 
 var Validate = validator.New()
+
+const MergePatchContentType = "application/merge-patch+json"
+
+const JSONPatchContentType = "application/json-patch+json"
+
+// paginationFromQuery reads page, limit, sort, cursor and filter[field][op]
+// parameters from the query string of the current request only.
+func paginationFromQuery(c *gin.Context) (genericcrud_repositories_gorm.Pagination, error) {
+	query := c.Request.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	pagination := genericcrud_repositories_gorm.NewPagination(limit, page, query.Get("sort"))
+	pagination.Cursor = query.Get("cursor")
+	pagination.Search = query.Get("q")
+
+	filters, err := genericcrud_repositories_gorm.ParseFilters(query)
+	pagination.Filters = filters
+	return pagination, err
+}
+
+// listPagination reads the pagination of a list request and rejects sort keys
+// and filters T does not allow, as well as forged cursors, with a 400. It
+// reports whether the handler may continue.
+func listPagination[T any](c *gin.Context) (genericcrud_repositories_gorm.Pagination, bool) {
+	pagination, err := paginationFromQuery(c)
+	if err == nil {
+		err = genericcrud_repositories_gorm.ValidatePagination[T](pagination)
+	}
+	if err != nil {
+		logging.LogError(fmt.Sprintf("invalid pagination: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return pagination, false
+	}
+	return pagination, true
+}
+
+// readContext carries the sparse fieldset of a read request, if any, to the
+// repository, and rejects fields T does not have with a 400. It reports
+// whether the handler may continue.
+func readContext[T any](c *gin.Context) (context.Context, genericcrud_repositories_gorm.Fieldset, bool) {
+	fieldset, err := genericcrud_repositories_gorm.ParseFieldset[T](c.Request.URL.Query())
+	if err != nil {
+		logging.LogError(fmt.Sprintf("invalid fieldset: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return c.Request.Context(), fieldset, false
+	}
+	if fieldset.Empty() {
+		return c.Request.Context(), fieldset, true
+	}
+	return genericcrud_repositories_gorm.WithFieldset(c.Request.Context(), fieldset), fieldset, true
+}
+
+// project keeps only the fields of the fieldset in the json of v.
+func project(v interface{}, fieldset genericcrud_repositories_gorm.Fieldset) (interface{}, error) {
+	if fieldset.Empty() {
+		return v, nil
+	}
+	return fieldset.Project(v)
+}
+
+// respondPage writes a page of rows, reduced to the fields of the fieldset,
+// together with its metadata, an X-Total-Count header and RFC 8288 Link
+// headers for the neighbouring pages.
+func respondPage[T any](c *gin.Context, page genericcrud_repositories_gorm.Page[T], fieldset genericcrud_repositories_gorm.Fieldset) {
+	rows, err := project(page.Rows, fieldset)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if page.Total >= 0 {
+		c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	}
+	if links := pageLinks(c.Request.URL, page); links != "" {
+		c.Header("Link", links)
+	}
+
+	c.JSON(OK, responses.SetPaginatedResponse(OK, "successful", rows, responses.PageMeta{
+		Total:      page.Total,
+		Page:       page.Page,
+		Limit:      page.Limit,
+		TotalPages: page.TotalPages,
+		HasNext:    page.HasNext,
+		HasPrev:    page.HasPrev,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	}))
+}
+
+// pageLinks links to the neighbouring pages by cursor when the page was
+// loaded through one, and by page number otherwise.
+func pageLinks[T any](requestUrl *url.URL, page genericcrud_repositories_gorm.Page[T]) string {
+	link := func(rel string, set map[string]string) string {
+		u := *requestUrl
+		query := u.Query()
+		query.Del("page")
+		query.Del("cursor")
+		query.Set("limit", strconv.Itoa(page.Limit))
+		for k, v := range set {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf("<%v>; rel=\"%v\"", u.RequestURI(), rel)
+	}
+
+	if page.Total < 0 {
+		links := []string{link("first", nil)}
+		if page.HasPrev && page.PrevCursor != "" {
+			links = append(links, link("prev", map[string]string{"cursor": page.PrevCursor}))
+		}
+		if page.HasNext && page.NextCursor != "" {
+			links = append(links, link("next", map[string]string{"cursor": page.NextCursor}))
+		}
+		return strings.Join(links, ", ")
+	}
+
+	if page.TotalPages == 0 {
+		return ""
+	}
+
+	pageNumber := func(p int) map[string]string {
+		return map[string]string{"page": strconv.Itoa(p)}
+	}
+	links := []string{link("first", pageNumber(1))}
+	if page.HasPrev {
+		links = append(links, link("prev", pageNumber(page.Page-1)))
+	}
+	if page.HasNext {
+		links = append(links, link("next", pageNumber(page.Page+1)))
+	}
+	links = append(links, link("last", pageNumber(page.TotalPages)))
+	return strings.Join(links, ", ")
+}
+
+// versionedContext carries the version named by the If-Match header, if any,
+// to the repository so that stale updates are refused.
+func versionedContext(c *gin.Context) (context.Context, error) {
+	ctx := c.Request.Context()
+	match := strings.TrimSpace(c.GetHeader("If-Match"))
+	if match == "" || match == "*" {
+		return ctx, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(match, "W/"), `"`), 10, 64)
+	if err != nil {
+		return ctx, fmt.Errorf("invalid If-Match header: %v", match)
+	}
+	return genericcrud_repositories_gorm.WithExpectedVersion(ctx, version), nil
+}
+
+// mediaType is the media type of the Content-Type header of the request,
+// lower cased and without parameters such as charset, or "" when the header
+// is missing or malformed.
+func mediaType(c *gin.Context) string {
+	contentType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return contentType
+}
+
+// setETag exposes the version of versioned models as an ETag for If-Match.
+func setETag[T any](c *gin.Context, row T) {
+	if version, ok := genericcrud_repositories_gorm.VersionOf(row); ok {
+		c.Header("ETag", fmt.Sprintf("\"%v\"", version))
+	}
+}
+
+// bulkFilterFromBody binds the body of a bulk write into target and checks
+// its filters against the configuration of T, answering a 400 when either
+// fails. It reports whether the handler may continue.
+func bulkFilterFromBody[T any](c *gin.Context, target interface{}, filter *genericcrud_repositories_gorm.BulkFilter) bool {
+	err := c.ShouldBindJSON(target)
+	if err == nil {
+		err = genericcrud_repositories_gorm.ValidateFilters[T](filter.Filters)
+	}
+	if err != nil {
+		logging.LogError(fmt.Sprintf("invalid bulk filter: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return false
+	}
+	return true
+}
+
+// idFromPath reads the id of T from the route: the :id parameter or, when the
+// route has none, one parameter per primary key column named after its json
+// field, e.g. /:tenantId/:sku for a key of (tenant_id, sku). Ids that do not
+// fit the key of T are answered with a 400. It reports whether the handler
+// may continue.
+func idFromPath[T any](c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if id == "" {
+		columns := genericcrud_repositories_gorm.PrimaryKeyColumns[T]()
+		parts := make([]string, len(columns))
+		for i, column := range columns {
+			parts[i] = c.Param(utils.ToCamelCaseLower(column))
+		}
+		id = strings.Join(parts, genericcrud_repositories_gorm.IdSeparator)
+	}
+
+	if _, err := genericcrud_repositories_gorm.ParseId[T](id); err != nil {
+		logging.LogError(err.Error())
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return "", false
+	}
+	return id, true
+}
+
+// setPathParams writes the params path parameters into the fields of model
+// with the same json names, converting them to the type of the field.
+func setPathParams(c *gin.Context, model interface{}, params ...string) error {
+	v := reflect.ValueOf(model).Elem()
+	for _, param := range params {
+		field, ok := jsonField(v, param)
+		if !ok {
+			return fmt.Errorf("%v has no field: %v", v.Type().Name(), param)
+		}
+
+		value := c.Param(param)
+		var err error
+		switch target := field.Addr().Interface().(type) {
+		case encoding.TextUnmarshaler:
+			err = target.UnmarshalText([]byte(value))
+		default:
+			if field.Kind() == reflect.String {
+				field.SetString(value)
+			} else {
+				err = json.Unmarshal([]byte(value), target)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %v: %v", param, value)
+		}
+	}
+	return nil
+}
+
+// jsonField finds the field of the struct v, or of its embedded structs,
+// encoded under name.
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		structField := v.Type().Field(i)
+		if structField.Anonymous && structField.Type.Kind() == reflect.Struct {
+			if field, ok := jsonField(v.Field(i), name); ok {
+				return field, true
+			}
+			continue
+		}
+		tag := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if tag == name || (tag == "" && strings.EqualFold(structField.Name, name)) {
+			return v.Field(i), structField.IsExported()
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var errorMapper = DefaultErrorStatus
+
+// SetErrorMapper replaces the function the handlers use to turn the errors of
+// services into http statuses. Mappers for errors of your own can fall back
+// to DefaultErrorStatus.
+func SetErrorMapper(mapper func(err error) int) {
+	errorMapper = mapper
+}
+
+// DefaultErrorStatus maps the error kinds of the repository package, e.g.
+// ErrNotFound or ErrConflict, and validator errors to http statuses. Any
+// other error is a 500.
+func DefaultErrorStatus(err error) int {
+	var validationErrors validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrors), errors.Is(err, genericcrud_repositories_gorm.ErrValidation):
+		return BadRequest
+	case errors.Is(err, genericcrud_repositories_gorm.ErrNotFound):
+		return NotFound
+	case errors.Is(err, genericcrud_repositories_gorm.ErrForbidden):
+		return Forbidden
+	case errors.Is(err, genericcrud_repositories_gorm.ErrPreconditionFailed):
+		return PreconditionFailed
+	case errors.Is(err, genericcrud_repositories_gorm.ErrConflict), errors.Is(err, utils.ErrJSONPatchTestFailed):
+		return Conflict
+	case errors.Is(err, genericcrud_repositories_gorm.ErrUnprocessable):
+		return UnprocessableEntity
+	}
+	return InternalServerError
+}
+
+// respondError answers err with the status the error mapper gives it. For
+// constraint violations the offending fields are returned instead of the
+// database error.
+func respondError(c *gin.Context, err error) {
+	status := errorMapper(err)
+	response := responses.SetResponse(status, "error", err.Error())
+
+	var violation *genericcrud_repositories_gorm.ConstraintError
+	if errors.As(err, &violation) {
+		response = responses.SetResponse(status, "error", violation.Error())
+		response.Data["constraint"] = violation.Type
+		response.Data["fields"] = append([]string{}, violation.Fields...)
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,26 @@
+package genericcontrollers_gorm_gin
+
+import (
+	"fmt"
+	"testing"
+
+	genericcrud_repositories_gorm "github.com/danielcomboni/generic-crud/genericcrud_repositories"
+)
+
+func TestDefaultErrorStatusOfConstraints(t *testing.T) {
+	cases := []struct {
+		constraint string
+		status     int
+	}{
+		{genericcrud_repositories_gorm.ConstraintUnique, Conflict},
+		{genericcrud_repositories_gorm.ConstraintNotNull, Conflict},
+		{genericcrud_repositories_gorm.ConstraintCheck, Conflict},
+		{genericcrud_repositories_gorm.ConstraintForeignKey, UnprocessableEntity},
+	}
+	for _, c := range cases {
+		violation := &genericcrud_repositories_gorm.ConstraintError{Type: c.constraint, Fields: []string{"email"}}
+		if status := DefaultErrorStatus(fmt.Errorf("failed to create: %w", violation)); status != c.status {
+			t.Errorf("%v: expected %v, got %v", c.constraint, c.status, status)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package genericcontrollers_gorm_gin
 
 import (
+	"context"
 	"fmt"
 	genericcrud_repositories_gorm "github.com/danielcomboni/generic-crud/genericcrud_repositories"
 	"github.com/danielcomboni/generic-crud/logging"
@@ -10,7 +11,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
-	"strconv"
 )
 
 const BadRequest = http.StatusBadRequest
@@ -19,8 +19,13 @@ const Created = http.StatusCreated
 const OK = http.StatusOK
 const NotFound = http.StatusNotFound
 const UnAuthorized = http.StatusUnauthorized
+const Forbidden = http.StatusForbidden
+const Conflict = responses.ConflictOrDuplicateOrAlreadyExists
+const PreconditionFailed = responses.PreconditionFailed
+const UnsupportedMediaType = http.StatusUnsupportedMediaType
+const UnprocessableEntity = http.StatusUnprocessableEntity
 
-func Create[T any](model *T, c *gin.Context, fnServiceCreate func(t T) (T, responses.GenericResponse, error)) {
+func Create[T any](model *T, c *gin.Context, fnServiceCreate func(ctx context.Context, t T) (T, responses.GenericResponse, error)) {
 
 	logging.LogIncoming(model)
 
@@ -39,10 +44,10 @@ func Create[T any](model *T, c *gin.Context, fnServiceCreate func(t T) (T, respo
 	}
 
 	// save (insert) to database
-	created, res, err := fnServiceCreate(*model)
+	created, res, err := fnServiceCreate(c.Request.Context(), *model)
 	if err != nil {
 		logging.LogError(fmt.Sprintf("failed to save record: %v", err))
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
 
@@ -57,7 +62,7 @@ func Create[T any](model *T, c *gin.Context, fnServiceCreate func(t T) (T, respo
 
 }
 
-func CreateBatch[T any](model []T, c *gin.Context, fnServiceCreate func(t []T) ([]T, responses.GenericResponse, error)) {
+func CreateBatch[T any](model []T, c *gin.Context, fnServiceCreate func(ctx context.Context, t []T) ([]T, responses.GenericResponse, error)) {
 
 	//Validate the request body
 	if err := c.BindJSON(&model); err != nil {
@@ -76,10 +81,10 @@ func CreateBatch[T any](model []T, c *gin.Context, fnServiceCreate func(t []T) (
 	}
 
 	// save (insert) to database
-	created, res, err := fnServiceCreate(model)
+	created, res, err := fnServiceCreate(c.Request.Context(), model)
 	if err != nil {
 		logging.LogError(fmt.Sprintf("failed to save record: %v", err))
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
 
@@ -93,8 +98,65 @@ func CreateBatch[T any](model []T, c *gin.Context, fnServiceCreate func(t []T) (
 
 }
 
-func UpdateById[T any](model *T, c *gin.Context, fnServiceUpdate func(t T, id string) (T, error)) {
-	id := c.Param("id")
+// Upsert answers PUT requests addressed by a natural key, e.g.
+// PUT /products/:sku. The keyParams path parameters are written into the
+// fields with the same json names before the model is validated, and an
+// If-Match header makes the update of an existing row conditional on its
+// version. The response is 201 when the service reports a new row and 200
+// when an existing one was updated.
+func Upsert[T any](model *T, c *gin.Context, fnServiceUpsert func(ctx context.Context, t T) (T, bool, error), keyParams ...string) {
+	ctx, err := versionedContext(c)
+	if err != nil {
+		logging.LogError(err.Error())
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
+
+	if err := c.BindJSON(model); err != nil {
+		logging.LogError(fmt.Sprintf("failed to bind incoming object: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
+
+	if err := setPathParams(c, model, keyParams...); err != nil {
+		logging.LogError(fmt.Sprintf("failed to bind incoming object: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
+
+	//use the validator library to Validate required fields
+	if validationErr := Validate.Struct(model); validationErr != nil {
+		logging.LogError(fmt.Sprintf("failed to Validate incoming object: %v", validationErr))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", validationErr.Error()))
+		return
+	}
+
+	row, inserted, err := fnServiceUpsert(ctx, *model)
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to upsert record: %v", err))
+		respondError(c, err)
+		return
+	}
+
+	if inserted {
+		c.JSON(Created, responses.SetResponse(Created, "successful", row))
+		return
+	}
+	c.JSON(OK, responses.SetResponse(OK, "successful", row))
+}
+
+func UpdateById[T any](model *T, c *gin.Context, fnServiceUpdate func(ctx context.Context, t T, id string) (T, error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	ctx, err := versionedContext(c)
+	if err != nil {
+		logging.LogError(err.Error())
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
+
 	//Validate the request body
 	if err := c.BindJSON(&model); err != nil {
 		logging.LogError(fmt.Sprintf("failed to bind incoming object: %v", err))
@@ -110,18 +172,26 @@ func UpdateById[T any](model *T, c *gin.Context, fnServiceUpdate func(t T, id st
 	}
 
 	// save (insert) to database
-	created, err := fnServiceUpdate(*model, id)
+	created, err := fnServiceUpdate(ctx, *model, id)
 	if err != nil {
 		logging.LogError(fmt.Sprintf("failed to update record: %v", err))
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
 
+	setETag(c, created)
 	c.JSON(Created, responses.SetResponse(Created, "successful", created))
 
 }
 
-func PatchById[T any](model *models.PatchByIdModel, c *gin.Context, fnServicePatch func(object models.PatchByIdModel) (T, error)) {
+func PatchById[T any](model *models.PatchByIdModel, c *gin.Context, fnServicePatch func(ctx context.Context, object models.PatchByIdModel) (T, error)) {
+	ctx, err := versionedContext(c)
+	if err != nil {
+		logging.LogError(err.Error())
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
+
 	//Validate the request body
 	if err := c.BindJSON(&model); err != nil {
 		logging.LogError(fmt.Sprintf("failed to bind incoming object: %v", err))
@@ -137,56 +207,140 @@ func PatchById[T any](model *models.PatchByIdModel, c *gin.Context, fnServicePat
 	}
 
 	// save (insert) to database
-	created, err := fnServicePatch(*model)
+	created, err := fnServicePatch(ctx, *model)
 	if err != nil {
 		logging.LogError(fmt.Sprintf("failed to patch record: %v", err))
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
 
+	setETag(c, created)
 	c.JSON(Created, responses.SetResponse(Created, "successful", created))
 
 }
 
-func GetAll[T any](c *gin.Context, fnServiceGetAll func() ([]T, error)) {
-	page, _ := strconv.Atoi(c.Request.URL.Query().Get("page"))
-	sort := c.Request.URL.Query().Get("sort")
-	limit, _ := strconv.Atoi(c.Request.URL.Query().Get("limit"))
+// MergePatchById answers PATCH /:id requests with an RFC 7396 merge patch
+// body (Content-Type: application/merge-patch+json). The id is taken from the
+// route and the If-Match header, when present, guards versioned models. The
+// service is handed Validate.Struct to check the patched row with, see
+// genericcrud_repositories_gorm.MergePatchById.
+func MergePatchById[T any](c *gin.Context, fnServiceMergePatch func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (T, error)) {
+	patchDocument(c, MergePatchContentType, fnServiceMergePatch)
+}
 
-	genericcrud_repositories_gorm.SetPagination(limit, page, sort)
+// JSONPatchById answers PATCH requests carrying an RFC 6902 JSON patch. A
+// failing test operation is answered with 409.
+func JSONPatchById[T any](c *gin.Context, fnServiceJSONPatch func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (T, error)) {
+	patchDocument(c, JSONPatchContentType, fnServiceJSONPatch)
+}
 
-	rows, err := fnServiceGetAll()
+// PatchByContentType answers a single PATCH /:id route with the handler the
+// Content-Type of the request asks for: MergePatchById for
+// application/merge-patch+json, JSONPatchById for application/json-patch+json
+// and PatchById for plain application/json, whose body may then leave the id
+// to the route. Media type parameters such as charset are ignored. Content
+// types without a service, or unknown ones, are answered with 415.
+func PatchByContentType[T any](c *gin.Context, fnServiceMergePatch func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (T, error), fnServiceJSONPatch func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (T, error), fnServicePatch func(ctx context.Context, object models.PatchByIdModel) (T, error)) {
+	switch contentType := mediaType(c); {
+	case contentType == MergePatchContentType && fnServiceMergePatch != nil:
+		MergePatchById(c, fnServiceMergePatch)
+	case contentType == JSONPatchContentType && fnServiceJSONPatch != nil:
+		JSONPatchById(c, fnServiceJSONPatch)
+	case contentType == gin.MIMEJSON && fnServicePatch != nil:
+		PatchById(&models.PatchByIdModel{Id: c.Param("id")}, c, fnServicePatch)
+	default:
+		msg := fmt.Sprintf("unsupported content type: %v", c.GetHeader("Content-Type"))
+		logging.LogError(msg)
+		c.JSON(UnsupportedMediaType, responses.SetResponse(UnsupportedMediaType, "error", msg))
+	}
+}
+
+// patchDocument reads a patch document of the given content type and hands it
+// to fnServicePatch along with the If-Match version.
+func patchDocument[T any](c *gin.Context, contentType string, fnServicePatch func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (T, error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	if mediaType(c) != contentType {
+		msg := fmt.Sprintf("expected content type: %v", contentType)
+		logging.LogError(msg)
+		c.JSON(UnsupportedMediaType, responses.SetResponse(UnsupportedMediaType, "error", msg))
+		return
+	}
+
+	ctx, err := versionedContext(c)
 	if err != nil {
+		logging.LogError(err.Error())
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
 
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+	patch, err := c.GetRawData()
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to read incoming patch: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
 		return
 	}
-	c.JSON(OK, responses.SetResponse(OK, "successful", rows))
+
+	patched, err := fnServicePatch(ctx, id, patch, Validate.Struct)
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to patch record: %v", err))
+		respondError(c, err)
+		return
+	}
+
+	setETag(c, patched)
+	c.JSON(OK, responses.SetResponse(OK, "successful", patched))
 }
 
-func GetAllByClientId[T any](c *gin.Context, fnServiceGetAll func(id string) ([]T, error)) {
-	id := c.Param("clientId")
+func GetAll[T any](c *gin.Context, fnServiceGetAll func(ctx context.Context, pagination genericcrud_repositories_gorm.Pagination) (genericcrud_repositories_gorm.Page[T], error)) {
+	pagination, ok := listPagination[T](c)
+	if !ok {
+		return
+	}
+	ctx, fieldset, ok := readContext[T](c)
+	if !ok {
+		return
+	}
 
-	page, _ := strconv.Atoi(c.Request.URL.Query().Get("page"))
-	sort := c.Request.URL.Query().Get("sort")
-	limit, _ := strconv.Atoi(c.Request.URL.Query().Get("limit"))
+	page, err := fnServiceGetAll(ctx, pagination)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondPage(c, page, fieldset)
+}
 
-	genericcrud_repositories_gorm.SetPagination(limit, page, sort)
+func GetAllByClientId[T any](c *gin.Context, fnServiceGetAll func(ctx context.Context, id string, pagination genericcrud_repositories_gorm.Pagination) (genericcrud_repositories_gorm.Page[T], error)) {
+	id := c.Param("clientId")
+	pagination, ok := listPagination[T](c)
+	if !ok {
+		return
+	}
+	ctx, fieldset, ok := readContext[T](c)
+	if !ok {
+		return
+	}
 
-	rows, err := fnServiceGetAll(id)
+	page, err := fnServiceGetAll(ctx, id, pagination)
 	if err != nil {
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
-	c.JSON(OK, responses.SetResponse(OK, "successful", rows))
+	respondPage(c, page, fieldset)
 }
 
-func GetAllByOtherPathParamsId[T any](c *gin.Context, fnServiceGetAll func(pathParams ...genericcrud_repositories_gorm.PathParams) ([]T, error), pathParams ...string) {
+func GetAllByOtherPathParamsId[T any](c *gin.Context, fnServiceGetAll func(ctx context.Context, pagination genericcrud_repositories_gorm.Pagination, pathParams ...genericcrud_repositories_gorm.PathParams) (genericcrud_repositories_gorm.Page[T], error), pathParams ...string) {
 	//id := c.Param("clientId")
-	page, _ := strconv.Atoi(c.Request.URL.Query().Get("page"))
-	sort := c.Request.URL.Query().Get("sort")
-	limit, _ := strconv.Atoi(c.Request.URL.Query().Get("limit"))
-	genericcrud_repositories_gorm.SetPagination(limit, page, sort)
+	pagination, ok := listPagination[T](c)
+	if !ok {
+		return
+	}
+	ctx, fieldset, ok := readContext[T](c)
+	if !ok {
+		return
+	}
 	var params []genericcrud_repositories_gorm.PathParams
 	for _, param := range c.Params {
 		params = append(params, genericcrud_repositories_gorm.PathParams{
@@ -194,43 +348,171 @@ func GetAllByOtherPathParamsId[T any](c *gin.Context, fnServiceGetAll func(pathP
 			Value: param.Value,
 		})
 	}
-	rows, err := fnServiceGetAll(params...)
+	page, err := fnServiceGetAll(ctx, pagination, params...)
 	if err != nil {
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
-	c.JSON(OK, responses.SetResponse(OK, "successful", rows))
+	respondPage(c, page, fieldset)
 }
 
-func GetOneById[T any](c *gin.Context, fnServiceGetOneById func(id string) (T, error)) {
-	id := c.Param("id")
-	row, err := fnServiceGetOneById(id)
+func GetOneById[T any](c *gin.Context, fnServiceGetOneById func(ctx context.Context, id string) (T, error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	ctx, fieldset, ok := readContext[T](c)
+	if !ok {
+		return
+	}
+	row, err := fnServiceGetOneById(ctx, id)
 	if err != nil {
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
-	if utils.IsNullOrEmpty(utils.SafeGetFromInterface(row, "$.id")) {
-		c.JSON(OK, responses.SetResponse(NotFound, "not found", nil))
+	if !genericcrud_repositories_gorm.HasPrimaryKey(row) {
+		c.JSON(NotFound, responses.SetResponse(NotFound, "not found", nil))
 		return
 	}
-	c.JSON(OK, responses.SetResponse(OK, "successful", row))
+	projected, err := project(row, fieldset)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	setETag(c, row)
+	c.JSON(OK, responses.SetResponse(OK, "successful", projected))
 }
 
-func DeleteSoftlyById[T any](c *gin.Context, fnServiceDeleteSoftlyById func(id string) (int64, error)) {
-	id := c.Param("id")
-	rowsAffected, err := fnServiceDeleteSoftlyById(id)
+func DeleteSoftlyById[T any](c *gin.Context, fnServiceDeleteSoftlyById func(ctx context.Context, id string) (int64, error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	rowsAffected, err := fnServiceDeleteSoftlyById(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(OK, responses.SetResponse(OK, "successful", rowsAffected))
+}
+
+func DeletePermanentlyById[T any](c *gin.Context, fnServiceDeletePermanentlyById func(ctx context.Context, id string) (int64, error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	rowsAffected, err := fnServiceDeletePermanentlyById(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		respondError(c, err)
 		return
 	}
 	c.JSON(OK, responses.SetResponse(OK, "successful", rowsAffected))
 }
 
-func DeletePermanentlyById[T any](c *gin.Context, fnServiceDeletePermanentlyById func(id string) (int64, error)) {
-	id := c.Param("id")
-	rowsAffected, err := fnServiceDeletePermanentlyById(id)
+// RestoreById answers POST /:id/restore by bringing back a soft deleted row.
+func RestoreById[T any](c *gin.Context, fnServiceRestoreById func(ctx context.Context, id string) (T, error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	restored, err := fnServiceRestoreById(c.Request.Context(), id)
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to restore record: %v", err))
+		respondError(c, err)
+		return
+	}
+	setETag(c, restored)
+	c.JSON(OK, responses.SetResponse(OK, "successful", restored))
+}
+
+// GetAllSoftDeleted answers GET /trash with a page of the soft deleted rows,
+// paginated, sorted and filtered like GetAll.
+func GetAllSoftDeleted[T any](c *gin.Context, fnServiceGetAllSoftDeleted func(ctx context.Context, pagination genericcrud_repositories_gorm.Pagination) (genericcrud_repositories_gorm.Page[T], error)) {
+	GetAll(c, fnServiceGetAllSoftDeleted)
+}
+
+// GetHistoryById answers GET /:id/history with a page of the audit entries of
+// a row, oldest first; they may be sorted by id or timestamp and filtered by
+// operation, actor and timestamp.
+func GetHistoryById[T any](c *gin.Context, fnServiceGetHistoryById func(ctx context.Context, id string, pagination genericcrud_repositories_gorm.Pagination) (genericcrud_repositories_gorm.Page[genericcrud_repositories_gorm.AuditEntry], error)) {
+	id, ok := idFromPath[T](c)
+	if !ok {
+		return
+	}
+	pagination, ok := listPagination[genericcrud_repositories_gorm.AuditEntry](c)
+	if !ok {
+		return
+	}
+
+	page, err := fnServiceGetHistoryById(c.Request.Context(), id, pagination)
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to retrieve history: %v", err))
+		respondError(c, err)
+		return
+	}
+	respondPage(c, page, genericcrud_repositories_gorm.Fieldset{})
+}
+
+// Aggregate answers GET /aggregate?groupBy=status&metrics=count,sum:amount with
+// one row per group holding the values of its group by fields and metrics. It
+// takes the filters of the list endpoints; group by fields and metric fields
+// must be allowed for T.
+func Aggregate[T any](c *gin.Context, fnServiceAggregate func(ctx context.Context, aggregation genericcrud_repositories_gorm.Aggregation) ([]genericcrud_repositories_gorm.AggregateRow, error)) {
+	aggregation, err := genericcrud_repositories_gorm.ParseAggregation(c.Request.URL.Query())
+	if err == nil {
+		err = genericcrud_repositories_gorm.ValidateAggregation[T](aggregation)
+	}
+	if err != nil {
+		logging.LogError(fmt.Sprintf("invalid aggregation: %v", err))
+		c.JSON(BadRequest, responses.SetResponse(BadRequest, "error", err.Error()))
+		return
+	}
+
+	rows, err := fnServiceAggregate(c.Request.Context(), aggregation)
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to aggregate: %v", err))
+		respondError(c, err)
+		return
+	}
+	c.JSON(OK, responses.SetResponse(OK, "successful", rows))
+}
+
+// UpdateWhere answers bulk updates whose body holds the filter selecting the
+// rows and the values to write, e.g.
+// {"filters": [{"field": "status", "op": "eq", "value": "draft"}], "values": {"status": "archived"}}.
+// With "dryRun": true the rows are only counted. The response holds the
+// number of rows affected.
+func UpdateWhere[T any](c *gin.Context, fnServiceUpdateWhere func(ctx context.Context, filter genericcrud_repositories_gorm.BulkFilter, values map[string]interface{}) (int64, error)) {
+	var body struct {
+		genericcrud_repositories_gorm.BulkFilter
+		Values map[string]interface{} `json:"values"`
+	}
+	if !bulkFilterFromBody[T](c, &body, &body.BulkFilter) {
+		return
+	}
+
+	rowsAffected, err := fnServiceUpdateWhere(c.Request.Context(), body.BulkFilter, body.Values)
+	if err != nil {
+		logging.LogError(fmt.Sprintf("failed to update records: %v", err))
+		respondError(c, err)
+		return
+	}
+	c.JSON(OK, responses.SetResponse(OK, "successful", rowsAffected))
+}
+
+// DeleteWhere answers bulk deletes whose body holds the filter selecting the
+// rows, e.g. {"filters": [...], "dryRun": true}. fnServiceDeleteWhere decides
+// whether the rows are deleted softly or not.
+func DeleteWhere[T any](c *gin.Context, fnServiceDeleteWhere func(ctx context.Context, filter genericcrud_repositories_gorm.BulkFilter) (int64, error)) {
+	var filter genericcrud_repositories_gorm.BulkFilter
+	if !bulkFilterFromBody[T](c, &filter, &filter) {
+		return
+	}
+
+	rowsAffected, err := fnServiceDeleteWhere(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(InternalServerError, responses.SetResponse(InternalServerError, "error", err.Error()))
+		logging.LogError(fmt.Sprintf("failed to delete records: %v", err))
+		respondError(c, err)
 		return
 	}
 	c.JSON(OK, responses.SetResponse(OK, "successful", rowsAffected))
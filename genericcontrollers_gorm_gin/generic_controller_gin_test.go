@@ -0,0 +1,61 @@
+package genericcontrollers_gorm_gin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danielcomboni/generic-crud/models"
+	"github.com/gin-gonic/gin"
+)
+
+type patchedModel struct {
+	Id   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestPatchByContentType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var called string
+	document := func(name string) func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (patchedModel, error) {
+		return func(ctx context.Context, id string, patch []byte, validate func(interface{}) error) (patchedModel, error) {
+			if validate == nil {
+				t.Errorf("%v: expected the patched row to be validated", name)
+			}
+			called = name + " " + id
+			return patchedModel{}, nil
+		}
+	}
+	router := gin.New()
+	router.PATCH("/:id", func(c *gin.Context) {
+		PatchByContentType(c, document("merge"), document("json-patch"), func(ctx context.Context, object models.PatchByIdModel) (patchedModel, error) {
+			called = "column " + object.Id
+			return patchedModel{}, nil
+		})
+	})
+
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+		called      string
+	}{
+		{"application/merge-patch+json; charset=utf-8", `{"name":"a"}`, OK, "merge 7"},
+		{"Application/JSON-Patch+JSON", `[{"op":"replace","path":"/name","value":"a"}]`, OK, "json-patch 7"},
+		{"application/json; charset=utf-8", `{"columnName":"name","patchValue":"a"}`, Created, "column 7"},
+		{"text/plain", `name=a`, UnsupportedMediaType, ""},
+		{"", `{}`, UnsupportedMediaType, ""},
+	}
+	for _, c := range cases {
+		called = ""
+		request := httptest.NewRequest(http.MethodPatch, "/7", strings.NewReader(c.body))
+		request.Header.Set("Content-Type", c.contentType)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != c.status || called != c.called {
+			t.Errorf("%q: expected %v %q, got %v %q %v", c.contentType, c.status, c.called, response.Code, called, response.Body)
+		}
+	}
+}
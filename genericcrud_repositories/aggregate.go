@@ -0,0 +1,335 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	MetricCount = "count"
+	MetricSum   = "sum"
+	MetricAvg   = "avg"
+	MetricMin   = "min"
+	MetricMax   = "max"
+)
+
+var metricFunctions = map[string]bool{
+	MetricCount: true, MetricSum: true, MetricAvg: true, MetricMin: true, MetricMax: true,
+}
+
+// Metric is an aggregate function over a json field of a model, written as
+// "sum:amount". count takes no field and counts rows; count:field counts the
+// rows whose field is not null.
+type Metric struct {
+	Function string `json:"function"`
+	Field    string `json:"field,omitempty"`
+}
+
+func (m Metric) String() string {
+	if m.Field == "" {
+		return m.Function
+	}
+	return m.Function + ":" + m.Field
+}
+
+// Aggregation groups the rows of a model matched by Filters by the json fields
+// of GroupBy and computes Metrics over each group. Without GroupBy the metrics
+// are computed over all the rows.
+type Aggregation struct {
+	GroupBy []string `json:"groupBy"`
+	Metrics []Metric `json:"metrics"`
+	Filters Filters  `json:"filters"`
+}
+
+// AggregateRow is a group of an aggregation. Group holds the values of the
+// group by fields and Metrics the value of each metric keyed as it was written,
+// e.g. "sum:amount". Group values, min and max have the go type of their field,
+// count is an int64 and sum and avg are float64; they are nil when the group
+// has no value to aggregate.
+type AggregateRow struct {
+	Group   map[string]interface{} `json:"group"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+// ParseAggregation reads an aggregation written as
+// groupBy=status&metrics=count,sum:amount together with the filters of a list,
+// from a query string. metrics defaults to count.
+func ParseAggregation(query url.Values) (Aggregation, error) {
+	var aggregation Aggregation
+	for _, value := range query["groupBy"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				aggregation.GroupBy = append(aggregation.GroupBy, field)
+			}
+		}
+	}
+
+	for _, value := range query["metrics"] {
+		for _, metric := range strings.Split(value, ",") {
+			metric = strings.TrimSpace(metric)
+			if metric == "" {
+				continue
+			}
+			function, field, _ := strings.Cut(metric, ":")
+			aggregation.Metrics = append(aggregation.Metrics, Metric{Function: strings.ToLower(function), Field: field})
+		}
+	}
+	if len(aggregation.Metrics) == 0 {
+		aggregation.Metrics = []Metric{{Function: MetricCount}}
+	}
+
+	filters, err := ParseFilters(query)
+	aggregation.Filters = filters
+	return aggregation, err
+}
+
+// SetGroupableFields registers the json field names T may be grouped by.
+// Grouping by any other field is rejected.
+func SetGroupableFields[T any](fields ...string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.groupableFields = fieldSet(fields)
+	})
+}
+
+// SetAggregatableFields registers the json field names whose values metrics of
+// T may aggregate. Metrics on any other field are rejected; count without a
+// field is always allowed.
+func SetAggregatableFields[T any](fields ...string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.aggregatableFields = fieldSet(fields)
+	})
+}
+
+// ValidateAggregation checks the group by fields, metrics and filters of
+// aggregation against the configuration of T. Its errors match ErrValidation.
+func ValidateAggregation[T any](aggregation Aggregation) error {
+	return withKind(ErrValidation, validateAggregation[T](aggregation))
+}
+
+func validateAggregation[T any](aggregation Aggregation) error {
+	settings := getModelSettings[T]()
+	for _, field := range aggregation.GroupBy {
+		if !settings.groupableFields[utils.ToCamelCaseLower(field)] {
+			return fmt.Errorf("cannot group %v by: %v", modelType[T]().Name(), field)
+		}
+	}
+
+	if len(aggregation.Metrics) == 0 {
+		return fmt.Errorf("aggregation of %v needs at least one metric", modelType[T]().Name())
+	}
+	for _, metric := range aggregation.Metrics {
+		if !metricFunctions[metric.Function] {
+			return fmt.Errorf("unknown metric: %v", metric)
+		}
+		if metric.Field == "" {
+			if metric.Function != MetricCount {
+				return fmt.Errorf("%v metric needs a field", metric.Function)
+			}
+			continue
+		}
+		if !settings.aggregatableFields[utils.ToCamelCaseLower(metric.Field)] {
+			return fmt.Errorf("cannot aggregate %v by: %v", modelType[T]().Name(), metric)
+		}
+	}
+	return validateFilters[T](aggregation.Filters)
+}
+
+// aggregateColumn is the field of sch a group by field or metric refers to.
+func aggregateColumn(sch *schema.Schema, name string) (*schema.Field, error) {
+	field := sch.LookUpField(utils.ToSnakeCase(utils.ToCamelCaseLower(name)))
+	if field == nil || field.DBName == "" {
+		return nil, withKind(ErrValidation, fmt.Errorf("%v has no column for: %v", sch.Name, name))
+	}
+	return field, nil
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Aggregate computes the metrics of aggregation over the rows of T matched by
+// its filters, one AggregateRow per group ordered by the group by fields. Soft
+// deleted rows are left out and, when T is scoped by tenant, so are the rows
+// of other tenants.
+func Aggregate[T any](ctx context.Context, databaseInstance *gorm.DB, aggregation Aggregation) ([]AggregateRow, error) {
+	log.Println(fmt.Sprintf("\n\naggregating: %v", modelType[T]().Name()))
+	results := []AggregateRow{}
+
+	if err := ValidateAggregation[T](aggregation); err != nil {
+		log.Println(fmt.Sprintf("invalid aggregation: %v %v", modelType[T]().Name(), err))
+		return results, err
+	}
+
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return results, err
+	}
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return results, err
+	}
+
+	var (
+		selects []string
+		vars    []interface{}
+		groups  []*schema.Field
+		fields  []*schema.Field
+		targets []func() interface{}
+	)
+	for _, name := range aggregation.GroupBy {
+		field, err := aggregateColumn(sch, name)
+		if err != nil {
+			return results, err
+		}
+		groups = append(groups, field)
+		selects = append(selects, "?")
+		vars = append(vars, clause.Column{Name: field.DBName})
+		targets = append(targets, func() interface{} { return new(interface{}) })
+	}
+
+	for _, metric := range aggregation.Metrics {
+		var field *schema.Field
+		if metric.Field != "" {
+			if field, err = aggregateColumn(sch, metric.Field); err != nil {
+				return results, err
+			}
+		}
+		fields = append(fields, field)
+
+		switch {
+		case metric.Function == MetricCount && field == nil:
+			selects = append(selects, "COUNT(*)")
+			targets = append(targets, func() interface{} { return new(int64) })
+			continue
+		case metric.Function == MetricCount:
+			targets = append(targets, func() interface{} { return new(int64) })
+		case metric.Function == MetricSum || metric.Function == MetricAvg:
+			if !isNumberKind(indirectType(field.FieldType).Kind()) {
+				return results, withKind(ErrValidation, fmt.Errorf("cannot %v non numeric field: %v", metric.Function, metric.Field))
+			}
+			targets = append(targets, func() interface{} { return new(sql.NullFloat64) })
+		default:
+			targets = append(targets, func() interface{} { return new(interface{}) })
+		}
+		selects = append(selects, strings.ToUpper(metric.Function)+"(?)")
+		vars = append(vars, clause.Column{Name: field.DBName})
+	}
+
+	query, err := filtersHandler[T](databaseInstance.Model(new(T)), aggregation.Filters)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to filter: %v %v", modelType[T]().Name(), err))
+		return results, err
+	}
+	query = query.Select(strings.Join(selects, ", "), vars...)
+	for _, field := range groups {
+		column := clause.Column{Name: field.DBName}
+		query = query.Group(field.DBName).Order(clause.OrderByColumn{Column: column})
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to aggregate: %v %v", modelType[T]().Name(), err))
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dest := make([]interface{}, len(targets))
+		for i, target := range targets {
+			dest[i] = target()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Println(fmt.Sprintf("failed to aggregate: %v %v", modelType[T]().Name(), err))
+			return results, err
+		}
+
+		result := AggregateRow{Group: map[string]interface{}{}, Metrics: map[string]interface{}{}}
+		for i, field := range groups {
+			result.Group[jsonName(field.StructField)] = aggregateValue(field, *dest[i].(*interface{}))
+		}
+		for i, metric := range aggregation.Metrics {
+			switch value := dest[len(groups)+i].(type) {
+			case *int64:
+				result.Metrics[metric.String()] = *value
+			case *sql.NullFloat64:
+				if value.Valid {
+					result.Metrics[metric.String()] = value.Float64
+				} else {
+					result.Metrics[metric.String()] = nil
+				}
+			case *interface{}:
+				result.Metrics[metric.String()] = aggregateValue(fields[i], *value)
+			}
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(fmt.Sprintf("failed to aggregate: %v %v", modelType[T]().Name(), err))
+		return results, err
+	}
+	return results, nil
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// timeLayouts are the layouts drivers such as sqlite return the min and max of
+// time columns in.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"}
+
+// aggregateValue converts a value read by the driver to the go type of field.
+// Values that do not convert, such as times some drivers return as text, are
+// returned as read.
+func aggregateValue(field *schema.Field, value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if value == nil {
+		return nil
+	}
+
+	fieldType := indirectType(field.FieldType)
+	if s, ok := value.(string); ok {
+		if fieldType == reflect.TypeOf(time.Time{}) {
+			for _, layout := range timeLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t
+				}
+			}
+		}
+		if converted, err := convertValue(fieldType, s); err == nil {
+			return converted
+		}
+		return value
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case isNumberKind(v.Kind()) && isNumberKind(fieldType.Kind()):
+		return v.Convert(fieldType).Interface()
+	case isNumberKind(v.Kind()) && fieldType.Kind() == reflect.Bool:
+		return reflect.ValueOf(v.Convert(reflect.TypeOf(float64(0))).Float() != 0).Convert(fieldType).Interface()
+	}
+	return value
+}
@@ -0,0 +1,48 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseAggregation(t *testing.T) {
+	query, _ := url.ParseQuery("groupBy=name&metrics=count,SUM:age&filter[age][gte]=18")
+	aggregation, err := ParseAggregation(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(aggregation.GroupBy, []string{"name"}) ||
+		!reflect.DeepEqual(aggregation.Metrics, []Metric{{Function: MetricCount}, {Function: MetricSum, Field: "age"}}) ||
+		len(aggregation.Filters) != 1 {
+		t.Errorf("unexpected aggregation: %+v", aggregation)
+	}
+
+	defaults, _ := ParseAggregation(url.Values{})
+	if !reflect.DeepEqual(defaults.Metrics, []Metric{{Function: MetricCount}}) {
+		t.Errorf("unexpected default metrics: %v", defaults.Metrics)
+	}
+}
+
+func TestValidateAggregation(t *testing.T) {
+	SetGroupableFields[memoryModel]("name")
+	SetAggregatableFields[memoryModel]("age")
+
+	valid := Aggregation{GroupBy: []string{"name"}, Metrics: []Metric{{Function: MetricCount}, {Function: MetricAvg, Field: "age"}}}
+	if err := ValidateAggregation[memoryModel](valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, aggregation := range []Aggregation{
+		{GroupBy: []string{"age"}, Metrics: []Metric{{Function: MetricCount}}},
+		{Metrics: []Metric{{Function: MetricSum, Field: "name"}}},
+		{Metrics: []Metric{{Function: MetricMax}}},
+		{Metrics: []Metric{{Function: "median", Field: "age"}}},
+		{},
+	} {
+		if err := ValidateAggregation[memoryModel](aggregation); !errors.Is(err, ErrValidation) {
+			t.Errorf("expected a validation error for %+v, got: %v", aggregation, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditOperation names the write an AuditEntry records.
+type AuditOperation string
+
+const (
+	AuditCreate          AuditOperation = "create"
+	AuditUpdate          AuditOperation = "update"
+	AuditPatch           AuditOperation = "patch"
+	AuditDeleteSoft      AuditOperation = "soft_delete"
+	AuditDeleteHard      AuditOperation = "hard_delete"
+	AuditDeletePermanent AuditOperation = "permanent_delete"
+	AuditRestore         AuditOperation = "restore"
+)
+
+// event is the kind of hooks run around the operation.
+func (o AuditOperation) event() hookEvent {
+	switch o {
+	case AuditCreate:
+		return hookCreate
+	case AuditUpdate, AuditPatch:
+		return hookUpdate
+	case AuditRestore:
+		return hookRestore
+	default:
+		return hookDelete
+	}
+}
+
+// AuditChange is the value of a field before and after a write. Old is absent
+// for creates and New for deletes.
+type AuditChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// AuditChanges are the changes of a write keyed by json field name. They are
+// stored as a json document.
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *AuditChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into audit changes", value)
+	}
+}
+
+// AuditEntry is a row of an audit table: who did which write to which row of
+// which model, when, and the fields it changed.
+type AuditEntry struct {
+	Id        uint64         `gorm:"primaryKey" json:"id"`
+	Model     string         `gorm:"size:255" json:"model"`
+	RecordId  string         `gorm:"size:255" json:"recordId"`
+	Operation AuditOperation `gorm:"size:32" json:"operation"`
+	Actor     string         `gorm:"size:255" json:"actor"`
+	Timestamp time.Time      `json:"timestamp"`
+	Changes   AuditChanges   `gorm:"type:text" json:"changes"`
+}
+
+func init() {
+	SetSortableFields[AuditEntry]("id", "timestamp")
+	SetFilterableFields[AuditEntry]("operation", "actor", "timestamp")
+}
+
+// SetAuditTable makes every Create, CreateBatch, UpdateById, PatchById,
+// MergePatchById, JSONPatchById, Delete*ById and RestoreById of T write an
+// AuditEntry to table in the transaction of the write. The table is expected
+// to exist, e.g. through db.Table(table).AutoMigrate(&AuditEntry{}); an empty
+// table turns auditing of T off. Bulk writes are not audited.
+func SetAuditTable[T any](table string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.auditTable = table
+	})
+}
+
+func audited[T any]() bool {
+	return getModelSettings[T]().auditTable != ""
+}
+
+type actorKey struct{}
+
+// WithActor records actor, e.g. the id of the authenticated user, as the
+// author of the writes done within ctx.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func Actor(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
+
+// audit writes the AuditEntry of operation on a row of T, when T is audited.
+func audit[T any](ctx context.Context, databaseInstance *gorm.DB, operation AuditOperation, old, new *T) error {
+	table := getModelSettings[T]().auditTable
+	if table == "" {
+		return nil
+	}
+
+	row := new
+	if row == nil {
+		row = old
+	}
+	if row == nil {
+		return nil
+	}
+
+	changes, err := auditChanges(old, new)
+	if err != nil {
+		return err
+	}
+
+	actor, _ := Actor(ctx)
+	entry := AuditEntry{
+		Model:     modelType[T]().Name(),
+		RecordId:  idOf(ctx, *row),
+		Operation: operation,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+		Changes:   changes,
+	}
+	if err := databaseInstance.Table(table).Create(&entry).Error; err != nil {
+		log.Println(fmt.Sprintf("failed to audit: %v of %v: %v", operation, entry.Model, err))
+		return err
+	}
+	return nil
+}
+
+// auditChanges lists the json fields whose values differ between old and new;
+// either may be nil.
+func auditChanges[T any](old, new *T) (AuditChanges, error) {
+	before, err := jsonMembers(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := jsonMembers(new)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := AuditChanges{}
+	for key, value := range before {
+		if _, ok := after[key]; !ok || !jsonEqual(value, after[key]) {
+			changes[key] = AuditChange{Old: value, New: after[key]}
+		}
+	}
+	for key, value := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = AuditChange{New: value}
+		}
+	}
+	return changes, nil
+}
+
+func jsonMembers[T any](row *T) (map[string]json.RawMessage, error) {
+	if row == nil {
+		return nil, nil
+	}
+	document, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(document, &members); err != nil {
+		return nil, fmt.Errorf("cannot audit %v: %w", reflect.TypeOf(row).Elem().Name(), err)
+	}
+	return members, nil
+}
+
+// GetHistoryById pages through the audit entries of the row of T with the
+// given id, oldest first unless pagination sorts them otherwise. When T is
+// scoped by tenant, only the history of the stored rows of the tenant of ctx
+// is found.
+func GetHistoryById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, pagination Pagination) (Page[AuditEntry], error) {
+	log.Println(fmt.Sprintf("\n\nretreiving history of: %v by id: %v", modelType[T]().Name(), id))
+	databaseInstance = connection(ctx, databaseInstance)
+
+	table := getModelSettings[T]().auditTable
+	if table == "" {
+		return newPage([]AuditEntry{}, 0, pagination), withKind(ErrNotFound, fmt.Errorf("%v is not audited", modelType[T]().Name()))
+	}
+
+	id, err := canonicalId[T](ctx, id)
+	if err != nil {
+		return newPage([]AuditEntry{}, 0, pagination), err
+	}
+
+	// the history of a row of another tenant is not found like the row
+	if tenantColumn[T](ctx) != "" {
+		if _, err := GetOneSoftDeletedById[T](ctx, databaseInstance, id); err != nil {
+			return newPage([]AuditEntry{}, 0, pagination), err
+		}
+	}
+
+	if pagination.Sort == "" && pagination.Cursor == "" {
+		pagination.Sort = "id"
+	}
+	query := databaseInstance.Table(table).Where("model = ? AND record_id = ?", modelType[T]().Name(), id)
+	return findPage[AuditEntry](ctx, query, pagination)
+}
@@ -0,0 +1,132 @@
+package genericcrud_repositories_gorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestAuditChanges(t *testing.T) {
+	old := memoryModel{Id: "1", Name: "ann", Age: 30}
+	new := old
+	new.Age = 31
+
+	changes, err := auditChanges(&old, &new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || string(changes["age"].Old) != "30" || string(changes["age"].New) != "31" {
+		t.Errorf("unexpected update changes: %v", changes)
+	}
+
+	created, _ := auditChanges[memoryModel](nil, &new)
+	if len(created) != 4 || created["name"].Old != nil || string(created["name"].New) != `"ann"` {
+		t.Errorf("unexpected create changes: %v", created)
+	}
+
+	deleted, _ := auditChanges[memoryModel](&old, nil)
+	if len(deleted) != 4 || deleted["age"].New != nil {
+		t.Errorf("unexpected delete changes: %v", deleted)
+	}
+
+	value, err := changes.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanned AuditChanges
+	if err := scanned.Scan(value); err != nil || !reflect.DeepEqual(scanned, changes) {
+		t.Errorf("changes do not round trip: %v %v", scanned, err)
+	}
+	if b, _ := json.Marshal(created["name"]); string(b) != `{"new":"ann"}` {
+		t.Errorf("unexpected json: %s", b)
+	}
+}
+
+type auditedInvoice struct {
+	Id        uint           `gorm:"primaryKey" json:"id"`
+	Number    string         `json:"number"`
+	Amount    int            `json:"amount"`
+	Status    string         `json:"status"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+// diff prints changes as old>new per field, in field order, with the time of
+// a soft delete left out.
+func diff(changes AuditChanges) string {
+	var fields []string
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var printed []string
+	for _, field := range fields {
+		old, new := string(changes[field].Old), string(changes[field].New)
+		if field == "deletedAt" && old != "" && old != "null" {
+			old = "time"
+		}
+		printed = append(printed, fmt.Sprintf("%v:%v>%v", field, old, new))
+	}
+	return strings.Join(printed, " ")
+}
+
+func TestGetHistoryById(t *testing.T) {
+	SetAuditTable[auditedInvoice]("invoice_audit")
+	t.Cleanup(func() { SetAuditTable[auditedInvoice]("") })
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&auditedInvoice{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Table("invoice_audit").AutoMigrate(&AuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	actor := WithActor(ctx, "ann")
+
+	if _, err := Create[auditedInvoice](actor, &auditedInvoice{Number: "inv-1", Amount: 100}, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpdateById[auditedInvoice](actor, db, auditedInvoice{Amount: 120, Status: "sent"}, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PatchById[auditedInvoice](actor, db, "1", "status", "paid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteSoftById[auditedInvoice](actor, db, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeletePermanentById[auditedInvoice](actor, db, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := GetHistoryById[auditedInvoice](ctx, db, "1", Pagination{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		operation AuditOperation
+		diff      string
+	}{
+		{AuditCreate, `amount:>100 deletedAt:>null id:>1 number:>"inv-1" status:>""`},
+		{AuditUpdate, `amount:100>120 status:"">"sent"`},
+		{AuditPatch, `status:"sent">"paid"`},
+		// the row leaves the live ones
+		{AuditDeleteSoft, `amount:120> deletedAt:null> id:1> number:"inv-1"> status:"paid">`},
+		{AuditDeletePermanent, `amount:120> deletedAt:time> id:1> number:"inv-1"> status:"paid">`},
+	}
+	if len(history.Rows) != len(expected) {
+		t.Fatalf("unexpected history: %+v", history.Rows)
+	}
+	for i, entry := range history.Rows {
+		if entry.Operation != expected[i].operation || entry.Actor != "ann" || entry.RecordId != "1" || entry.Model != "auditedInvoice" {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+		if got := diff(entry.Changes); got != expected[i].diff {
+			t.Errorf("%v: expected the changes %v, got %v", entry.Operation, expected[i].diff, got)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrEmptyFilter is returned by bulk writes given no condition at all, which
+// would otherwise write every row of the table.
+var ErrEmptyFilter = withKind(ErrValidation, errors.New("refusing to write every row: the filter is empty"))
+
+// ErrInvalidUpdate is returned by UpdateWhere for values that do not fit the
+// columns of the model.
+var ErrInvalidUpdate = withKind(ErrValidation, errors.New("invalid update"))
+
+// BulkFilter selects the rows of a bulk write with the same conditions
+// GetAllByFields takes: equality conditions by column and filters.
+type BulkFilter struct {
+	QueryMap map[string]interface{} `json:"-"`
+	Filters  Filters                `json:"filters"`
+	// AllowAll lets a filter without conditions select every row. It can only
+	// be set by code, never by a request body.
+	AllowAll bool `json:"-"`
+	// DryRun counts the rows the write would affect without writing them.
+	DryRun bool `json:"dryRun"`
+}
+
+func (f BulkFilter) empty() bool {
+	return len(f.QueryMap) == 0 && len(f.Filters) == 0
+}
+
+// bulkQuery applies filter to the rows of T, refusing an empty filter unless
+// it allows every row.
+func bulkQuery[T any](databaseInstance *gorm.DB, filter BulkFilter) (*gorm.DB, error) {
+	if filter.empty() {
+		if !filter.AllowAll {
+			return nil, ErrEmptyFilter
+		}
+		databaseInstance = databaseInstance.Session(&gorm.Session{AllowGlobalUpdate: true})
+	}
+
+	query := databaseInstance.Model(new(T))
+	if len(filter.QueryMap) > 0 {
+		query = query.Where(filter.QueryMap)
+	}
+	return filtersHandler[T](query, filter.Filters)
+}
+
+// bulkWrite runs write on the rows selected by filter, soft deleted ones
+// included when unscoped, or only counts them on a dry run, and returns the
+// number of rows affected.
+func bulkWrite[T any](ctx context.Context, databaseInstance *gorm.DB, filter BulkFilter, unscoped bool, write func(query *gorm.DB) *gorm.DB) (int64, error) {
+	ctx = transactionContext(ctx, databaseInstance)
+	if !filter.DryRun {
+		defer invalidate[T](ctx)
+	}
+
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return 0, err
+	}
+	if unscoped {
+		databaseInstance = databaseInstance.Unscoped()
+	}
+	query, err := bulkQuery[T](databaseInstance, filter)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to select rows of: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return 0, err
+	}
+
+	if filter.DryRun {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(fmt.Sprintf("failed to count rows of: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+			return 0, err
+		}
+		return count, nil
+	}
+
+	result := write(query)
+	if result.Error != nil {
+		log.Println(fmt.Sprintf("failed to write rows of: %v %v", reflect.TypeOf(*new(T)).Name(), result.Error))
+		return 0, translateError[T](ctx, databaseInstance, result.Error)
+	}
+	log.Println(fmt.Sprintf("rows affected: %v", utils.ConvertInt64ToStr(result.RowsAffected)))
+	return result.RowsAffected, nil
+}
+
+// updateColumns turns values keyed by field, json or column name into values
+// of the column types of T, keyed by column.
+func updateColumns[T any](ctx context.Context, databaseInstance *gorm.DB, values map[string]interface{}) (map[string]interface{}, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: no values to update", ErrInvalidUpdate)
+	}
+
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	for key, value := range values {
+		field := sch.LookUpField(utils.ToSnakeCase(utils.ToCamelCaseLower(key)))
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: %v has no column for: %v", ErrInvalidUpdate, sch.Name, key)
+		}
+		if field.PrimaryKey || isPrimaryKeyColumn[T](ctx, field.DBName) || isTenantColumn[T](ctx, field.DBName) || field.DBName == versionColumn[T]() {
+			return nil, fmt.Errorf("%w: %v cannot be updated", ErrInvalidUpdate, key)
+		}
+
+		// strings are read like filter values so that "9" fits an int column
+		if converted, err := convertValue(field.FieldType, value); err == nil {
+			value = converted
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid value for %v: %v", ErrInvalidUpdate, key, err)
+		}
+		converted := reflect.New(field.FieldType)
+		if err := json.Unmarshal(raw, converted.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: invalid value for %v: %v", ErrInvalidUpdate, key, err)
+		}
+		updates[field.DBName] = converted.Elem().Interface()
+	}
+
+	if column := versionColumn[T](); column != "" {
+		updates[column] = gorm.Expr("? + 1", clause.Column{Name: column})
+	}
+	return updates, nil
+}
+
+// UpdateWhere writes values to every row of T selected by filter and returns
+// the number of rows updated. The values are keyed by field, json or column
+// name; versioned rows have their version incremented.
+func UpdateWhere[T any](ctx context.Context, databaseInstance *gorm.DB, filter BulkFilter, values map[string]interface{}) (int64, error) {
+	log.Println(fmt.Sprintf("\n\nupdating rows of: %v where: %#v %#v", reflect.TypeOf(*new(T)).Name(), filter.QueryMap, filter.Filters))
+
+	updates, err := updateColumns[T](ctx, connection(ctx, databaseInstance), values)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to update: %v", err))
+		return 0, err
+	}
+
+	return bulkWrite[T](ctx, databaseInstance, filter, false, func(query *gorm.DB) *gorm.DB {
+		return query.Updates(updates)
+	})
+}
+
+// DeleteSoftWhere soft deletes every live row of T selected by filter and
+// returns the number of rows deleted. T must have a gorm.DeletedAt field.
+func DeleteSoftWhere[T any](ctx context.Context, databaseInstance *gorm.DB, filter BulkFilter) (int64, error) {
+	log.Println(fmt.Sprintf("\n\nsoft deleting rows of: %v where: %#v %#v", reflect.TypeOf(*new(T)).Name(), filter.QueryMap, filter.Filters))
+
+	if _, err := deletedAtColumn[T](connection(ctx, databaseInstance)); err != nil {
+		log.Println(fmt.Sprintf("failed to soft delete: %v", err))
+		return 0, err
+	}
+
+	return bulkWrite[T](ctx, databaseInstance, filter, false, func(query *gorm.DB) *gorm.DB {
+		return query.Delete(new(T))
+	})
+}
+
+// DeleteHardWhere permanently deletes every row of T selected by filter, soft
+// deleted ones included, like DeletePermanentlyById, and returns the number of
+// rows deleted.
+func DeleteHardWhere[T any](ctx context.Context, databaseInstance *gorm.DB, filter BulkFilter) (int64, error) {
+	log.Println(fmt.Sprintf("\n\nhard deleting rows of: %v where: %#v %#v", reflect.TypeOf(*new(T)).Name(), filter.QueryMap, filter.Filters))
+
+	return bulkWrite[T](ctx, databaseInstance, filter, true, func(query *gorm.DB) *gorm.DB {
+		return query.Delete(new(T))
+	})
+}
@@ -0,0 +1,83 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type shippedParcel struct {
+	Id        uint           `gorm:"primaryKey" json:"id"`
+	Label     string         `json:"label"`
+	Zone      int            `json:"zone"`
+	Status    string         `json:"status"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+// labels are the labels of the stored parcels, soft deleted ones included
+// when unscoped.
+func labels(t *testing.T, db *gorm.DB, unscoped bool) string {
+	t.Helper()
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var result []string
+	if err := db.Model(&shippedParcel{}).Order("label").Pluck("label", &result).Error; err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(result)
+}
+
+func TestBulkWrites(t *testing.T) {
+	SetFilterableFields[shippedParcel]("zone")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&shippedParcel{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]shippedParcel{{Label: "a", Zone: 1}, {Label: "b", Zone: 1}, {Label: "c", Zone: 2}, {Label: "d", Zone: 3}})
+
+	for _, write := range []func() (int64, error){
+		func() (int64, error) {
+			return UpdateWhere[shippedParcel](ctx, db, BulkFilter{}, map[string]interface{}{"status": "lost"})
+		},
+		func() (int64, error) { return DeleteSoftWhere[shippedParcel](ctx, db, BulkFilter{}) },
+		func() (int64, error) { return DeleteHardWhere[shippedParcel](ctx, db, BulkFilter{}) },
+	} {
+		if n, err := write(); !errors.Is(err, ErrEmptyFilter) || n != 0 {
+			t.Errorf("expected an empty filter to be refused, got %v %v", n, err)
+		}
+	}
+
+	zoneOne := BulkFilter{Filters: Filters{{Field: "zone", Operator: FilterEq, Value: "1"}}}
+	if n, err := UpdateWhere[shippedParcel](ctx, db, zoneOne, map[string]interface{}{"status": "sent"}); n != 2 || err != nil {
+		t.Fatalf("update: %v %v", n, err)
+	}
+	if n, err := DeleteSoftWhere[shippedParcel](ctx, db, BulkFilter{QueryMap: map[string]interface{}{"status": "sent"}}); n != 2 || err != nil {
+		t.Fatalf("soft delete: %v %v", n, err)
+	}
+	if live, all := labels(t, db, false), labels(t, db, true); live != "[c d]" || all != "[a b c d]" {
+		t.Errorf("expected a and b to be soft deleted, got %v %v", live, all)
+	}
+
+	upToTwo := BulkFilter{Filters: Filters{{Field: "zone", Operator: FilterLte, Value: "2"}}, DryRun: true}
+	if n, err := DeleteHardWhere[shippedParcel](ctx, db, upToTwo); n != 3 || err != nil {
+		t.Errorf("dry run: %v %v", n, err)
+	}
+	if all := labels(t, db, true); all != "[a b c d]" {
+		t.Errorf("expected a dry run to write nothing, got %v", all)
+	}
+
+	upToTwo.DryRun = false
+	if n, err := DeleteHardWhere[shippedParcel](ctx, db, upToTwo); n != 3 || err != nil {
+		t.Fatalf("hard delete: %v %v", n, err)
+	}
+	if all := labels(t, db, true); all != "[d]" {
+		t.Errorf("expected the rows to be gone, soft deleted ones included, got %v", all)
+	}
+
+	if n, err := UpdateWhere[shippedParcel](ctx, db, BulkFilter{AllowAll: true}, map[string]interface{}{"status": "lost"}); n != 1 || err != nil {
+		t.Errorf("expected an allowed empty filter to update every row, got %v %v", n, err)
+	}
+}
@@ -0,0 +1,279 @@
+package genericcrud_repositories_gorm
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Cache stores encoded reads of models under string keys. It may be shared by
+// several processes, e.g. backed by Redis with GET and SET EX, and may evict
+// entries whenever it needs to. Errors of a cache are logged and the read goes
+// to the database.
+type Cache interface {
+	// Get returns the value stored under key and whether there was one.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl, or until it is evicted when ttl is 0.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// SetCache makes GetOneById, GetAll, GetAllByFields and Search of T read
+// through cache, keeping rows and pages for ttl. Create, CreateBatch,
+// UpdateById, PatchById, MergePatchById, JSONPatchById, the Delete* functions,
+// RestoreById, Upsert, UpsertBatch and the bulk writes of T invalidate every
+// entry of T once they commit. Reads within a transaction bypass the cache. A
+// nil cache turns caching of T off. Reads through a databaseInstance given
+// conditions or other clauses of its own, e.g. db.Where(...) or db.Unscoped(),
+// are not cached.
+//
+// Rows are cached with the relations preloaded with them; writes to the
+// related models do not invalidate them, so ttl bounds how stale they get.
+func SetCache[T any](cache Cache, ttl time.Duration) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.cache = cache
+		s.cacheTTL = ttl
+	})
+}
+
+// cacheOf returns the cache of T, unless T has none, ctx is in a transaction,
+// whose reads may see writes that are not committed, or databaseInstance
+// carries clauses of its own, which the keys of the cache do not hold.
+func cacheOf[T any](ctx context.Context, databaseInstance *gorm.DB) (Cache, time.Duration, bool) {
+	settings := settingsOf[T](ctx)
+	if settings.cache == nil {
+		return nil, 0, false
+	}
+	if _, ok := TransactionFromContext(ctx); ok {
+		return nil, 0, false
+	}
+	if customized(databaseInstance) {
+		return nil, 0, false
+	}
+	return settings.cache, settings.cacheTTL, true
+}
+
+// customized reports whether databaseInstance was given conditions, scopes,
+// Unscoped or any other clause that may change what a read returns.
+func customized(databaseInstance *gorm.DB) bool {
+	if databaseInstance == nil || databaseInstance.Statement == nil {
+		return false
+	}
+	statement := databaseInstance.Statement
+	return statement.Unscoped || len(statement.Clauses) > 0 || statement.Table != "" || statement.TableExpr != nil ||
+		statement.Distinct || len(statement.Selects) > 0 || len(statement.Omits) > 0 || len(statement.Joins) > 0 ||
+		len(statement.Preloads) > 0 || reflect.ValueOf(statement).Elem().FieldByName("scopes").Len() > 0
+}
+
+func cachePrefix[T any]() string {
+	return "generic-crud:" + modelType[T]().PkgPath() + "." + modelType[T]().Name()
+}
+
+var generations uint64
+
+// newGeneration returns a value no generation of this process had before.
+func newGeneration() string {
+	return fmt.Sprintf("%x-%x", time.Now().UnixNano(), atomic.AddUint64(&generations, 1))
+}
+
+// generation returns the current generation of the entries of T. Entries are
+// keyed by generation, so that a write invalidates all of them at once by
+// starting a new one.
+func generation[T any](ctx context.Context, cache Cache) (string, error) {
+	key := cachePrefix[T]() + ":generation"
+	value, ok, err := cache.Get(ctx, key)
+	if err != nil || ok {
+		return string(value), err
+	}
+	// evicted or never set: the entries of the lost generation are unreachable
+	g := newGeneration()
+	return g, cache.Set(ctx, key, []byte(g), 0)
+}
+
+// invalidate drops the cached entries of T once the write done within ctx
+// commits.
+func invalidate[T any](ctx context.Context) {
+	cache := settingsOf[T](ctx).cache
+	if cache == nil {
+		return
+	}
+	onCommit(ctx, func() {
+		// the write is done, a cancelled ctx must not keep stale entries
+		if err := cache.Set(context.Background(), cachePrefix[T]()+":generation", []byte(newGeneration()), 0); err != nil {
+			log.Println(fmt.Sprintf("failed to invalidate cache of: %v %v", modelType[T]().Name(), err))
+		}
+	})
+}
+
+// cacheKey is the key of a read of T, made of the parts that change its result:
+// the tenant and fieldset of ctx and the given parts.
+func cacheKey[T any](ctx context.Context, cache Cache, kind string, parts ...interface{}) (string, error) {
+	g, err := generation[T](ctx, cache)
+	if err != nil {
+		return "", err
+	}
+
+	tenant, _ := Tenant(ctx)
+	fieldset, _ := FieldsetFromContext(ctx)
+	// json sorts the keys of maps, so equal queries give equal keys
+	document, err := json.Marshal(append([]interface{}{tenant, fieldset}, parts...))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(document)
+	return strings.Join([]string{cachePrefix[T](), g, kind, hex.EncodeToString(sum[:])}, ":"), nil
+}
+
+// cached returns the value cached under the key of a read of T, or loads and
+// caches it. Failures of the cache are logged and leave the value uncached.
+func cached[T, R any](ctx context.Context, databaseInstance *gorm.DB, kind string, parts []interface{}, load func() (R, error)) (R, error) {
+	cache, ttl, ok := cacheOf[T](ctx, databaseInstance)
+	if !ok {
+		return load()
+	}
+
+	key, err := cacheKey[T](ctx, cache, kind, parts...)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to read cache of: %v %v", modelType[T]().Name(), err))
+		return load()
+	}
+	if value, ok, err := cache.Get(ctx, key); err != nil {
+		log.Println(fmt.Sprintf("failed to read cache of: %v %v", modelType[T]().Name(), err))
+	} else if ok {
+		var result R
+		if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&result); err == nil {
+			log.Println(fmt.Sprintf("retrieved %v of: %v from cache", kind, modelType[T]().Name()))
+			return result, nil
+		}
+	}
+
+	result, err := load()
+	if err != nil {
+		return result, err
+	}
+	var value bytes.Buffer
+	if err := gob.NewEncoder(&value).Encode(result); err != nil {
+		log.Println(fmt.Sprintf("cannot cache: %v %v", modelType[T]().Name(), err))
+		return result, nil
+	}
+	if err := cache.Set(ctx, key, value.Bytes(), ttl); err != nil {
+		log.Println(fmt.Sprintf("failed to write cache of: %v %v", modelType[T]().Name(), err))
+	}
+	return result, nil
+}
+
+func cachedRow[T any](ctx context.Context, databaseInstance *gorm.DB, id string, preloads []string, load func() (T, error)) (T, error) {
+	if _, _, ok := cacheOf[T](ctx, databaseInstance); ok {
+		// ids that differ only in how they are written share their entry
+		if canonical, err := canonicalId[T](ctx, id); err == nil {
+			id = canonical
+		}
+	}
+	return cached[T](ctx, databaseInstance, "row", []interface{}{id, preloads}, load)
+}
+
+func cachedPage[T any](ctx context.Context, databaseInstance *gorm.DB, pagination Pagination, queryMap map[string]interface{}, preloads []string, load func() (Page[T], error)) (Page[T], error) {
+	if len(queryMap) == 0 {
+		queryMap = nil
+	}
+	page, err := cached[T](ctx, databaseInstance, "page", []interface{}{pagination.Normalized(), queryMap, preloads}, load)
+	if page.Rows == nil {
+		// gob does not tell empty slices from nil ones
+		page.Rows = []T{}
+	}
+	return page, err
+}
+
+// LRUCache is an in-memory Cache of a bounded number of entries, evicting the
+// least recently used ones first. It is safe for concurrent use.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+var _ Cache = (*LRUCache)(nil)
+
+// NewLRUCache returns an empty LRUCache holding up to capacity entries.
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRUCache{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len is the number of entries held, expired ones included until they are
+// read or evicted.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,103 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), 0)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("unexpected entry: %s %v", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("expected the entry to expire")
+	}
+	if _, ok, _ := c.Get(ctx, "c"); !ok || c.Len() != 1 {
+		t.Errorf("expected only the entry without ttl to remain, got %v entries", c.Len())
+	}
+}
+
+type cacheModel struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestCachedRowInvalidation(t *testing.T) {
+	SetCache[cacheModel](NewLRUCache(10), time.Minute)
+	loads := 0
+	load := func() (cacheModel, error) {
+		loads++
+		return cacheModel{Id: 1, Name: fmt.Sprint("v", loads)}, nil
+	}
+
+	first, _ := cachedRow[cacheModel](ctx, nil, "1", nil, load)
+	second, _ := cachedRow[cacheModel](ctx, nil, "1", nil, load)
+	if loads != 1 || second != first {
+		t.Errorf("expected one load, got %v: %v %v", loads, first, second)
+	}
+
+	tenant, _ := cachedRow[cacheModel](WithTenant(ctx, "t"), nil, "1", nil, load)
+	if loads != 2 || tenant.Name != "v2" {
+		t.Errorf("expected tenants not to share entries, got %v loads", loads)
+	}
+
+	invalidate[cacheModel](ctx)
+	third, _ := cachedRow[cacheModel](ctx, nil, "1", nil, load)
+	if loads != 3 || third.Name != "v3" {
+		t.Errorf("expected a load after invalidation, got %v: %v", loads, third)
+	}
+}
+
+type cachedScoreModel struct {
+	Id        uint           `json:"id"`
+	Score     int            `json:"score"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+func TestCacheSkipsCustomizedInstances(t *testing.T) {
+	cache := NewLRUCache(100)
+	SetCache[cachedScoreModel](cache, time.Minute)
+	t.Cleanup(func() { SetCache[cachedScoreModel](nil, 0) })
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&cachedScoreModel{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]cachedScoreModel{{Score: 1}, {Score: 2}})
+
+	for _, score := range []int{1, 2} {
+		page, err := GetAll[cachedScoreModel](ctx, db.Where("score = ?", score), Pagination{})
+		if err != nil || len(page.Rows) != 1 || page.Rows[0].Score != score {
+			t.Errorf("expected the row of score %v, got %+v %v", score, page.Rows, err)
+		}
+	}
+
+	if _, err := DeleteSoftById[cachedScoreModel](ctx, db, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := GetOneById[cachedScoreModel](ctx, db.Unscoped(), "1"); err != nil || !row.DeletedAt.Valid {
+		t.Fatalf("expected the soft deleted row, got %+v %v", row, err)
+	}
+	if row, err := GetOneById[cachedScoreModel](ctx, db, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the soft deleted row not to be found, got %+v %v", row, err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected only the generation to be cached, got %v entries", cache.Len())
+	}
+}
@@ -0,0 +1,203 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// The constraints a ConstraintError reports as violated.
+const (
+	ConstraintUnique     = "unique"
+	ConstraintForeignKey = "foreign_key"
+	ConstraintNotNull    = "not_null"
+	ConstraintCheck      = "check"
+)
+
+// ConstraintError is a write rejected by a database constraint. Fields holds
+// the json names of the fields of the model the constraint covers, when they
+// can be told from the driver error. A violated foreign key matches
+// ErrUnprocessable, as the row refers to one that does not exist; unique, not
+// null and check constraints match ErrConflict.
+type ConstraintError struct {
+	Type       string
+	Constraint string
+	Fields     []string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	subject := strings.Join(e.Fields, ", ")
+	if subject == "" {
+		subject = e.Constraint
+	}
+
+	var message string
+	switch e.Type {
+	case ConstraintUnique:
+		message = "duplicate value"
+	case ConstraintForeignKey:
+		message = "invalid reference"
+	case ConstraintNotNull:
+		message = "missing value"
+	default:
+		message = "check constraint violated"
+	}
+	if subject == "" {
+		return message
+	}
+	return fmt.Sprintf("%v for: %v", message, subject)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	if e.Type == ConstraintForeignKey {
+		return target == ErrUnprocessable
+	}
+	return target == ErrConflict
+}
+
+// constraintPatterns recognise the messages of SQLite, Postgres and MySQL.
+// The first group of each is the constraint name or the column list.
+var constraintPatterns = []struct {
+	constraint string
+	pattern    *regexp.Regexp
+	columns    bool
+}{
+	// SQLite
+	{ConstraintUnique, regexp.MustCompile(`UNIQUE constraint failed: (.+)`), true},
+	{ConstraintNotNull, regexp.MustCompile(`NOT NULL constraint failed: (.+)`), true},
+	{ConstraintForeignKey, regexp.MustCompile(`FOREIGN KEY constraint failed()`), false},
+	{ConstraintCheck, regexp.MustCompile(`CHECK constraint failed: (.+)`), false},
+	// Postgres
+	{ConstraintUnique, regexp.MustCompile(`violates unique constraint "([^"]+)"`), false},
+	{ConstraintForeignKey, regexp.MustCompile(`violates foreign key constraint "([^"]+)"`), false},
+	{ConstraintNotNull, regexp.MustCompile(`null value in column "([^"]+)"`), true},
+	{ConstraintCheck, regexp.MustCompile(`violates check constraint "([^"]+)"`), false},
+	// MySQL
+	{ConstraintUnique, regexp.MustCompile("Duplicate entry '.*' for key '([^']+)'"), false},
+	{ConstraintForeignKey, regexp.MustCompile("foreign key constraint fails \\(.*FOREIGN KEY \\(`([^)]+)`\\)"), true},
+	{ConstraintNotNull, regexp.MustCompile(`Column '([^']+)' cannot be null`), true},
+	{ConstraintCheck, regexp.MustCompile(`Check constraint '([^']+)' is violated`), false},
+}
+
+// pgKeyDetail is the Detail of a Postgres unique violation, e.g.
+// "Key (tenant_id, sku)=(acme, A-1) already exists."
+var pgKeyDetail = regexp.MustCompile(`Key \(([^)]+)\)=`)
+
+// parseConstraintError recognises a constraint violation in a driver error.
+// The columns it returns are bare column names.
+func parseConstraintError(err error) (*ConstraintError, []string) {
+	message := err.Error()
+	for _, p := range constraintPatterns {
+		match := p.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+
+		violation := &ConstraintError{Type: p.constraint, Err: err}
+		var columns []string
+		if p.columns {
+			for _, column := range strings.Split(match[1], ",") {
+				column = strings.Trim(strings.TrimSpace(column), "`\"")
+				if i := strings.LastIndex(column, "."); i >= 0 {
+					column = column[i+1:]
+				}
+				if column != "" {
+					columns = append(columns, column)
+				}
+			}
+		} else {
+			violation.Constraint = match[1]
+		}
+
+		// lib/pq and pgx keep the columns out of the message
+		if column := driverErrorField(err, "ColumnName", "Column"); column != "" && len(columns) == 0 {
+			columns = []string{column}
+		}
+		if detail := pgKeyDetail.FindStringSubmatch(driverErrorField(err, "Detail")); detail != nil && len(columns) == 0 {
+			for _, column := range strings.Split(detail[1], ",") {
+				columns = append(columns, strings.TrimSpace(column))
+			}
+		}
+		return violation, columns
+	}
+	return nil, nil
+}
+
+// driverErrorField reads a string field of the struct behind a driver error,
+// the first of names that is set.
+func driverErrorField(err error, names ...string) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		for _, name := range names {
+			if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String && f.String() != "" {
+				return f.String()
+			}
+		}
+	}
+	return ""
+}
+
+// jsonFieldName is the name field is known by in json.
+func jsonFieldName(field *schema.Field) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return utils.ToCamelCaseLower(field.Name)
+}
+
+// translateError turns constraint violations reported by the database into a
+// ConstraintError naming the fields of T involved. Other errors are returned
+// as they are.
+func translateError[T any](ctx context.Context, databaseInstance *gorm.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	violation, columns := parseConstraintError(err)
+	if violation == nil {
+		return err
+	}
+
+	sch, schemaErr := parseSchema[T](databaseInstance)
+	if schemaErr != nil {
+		return violation
+	}
+
+	if len(columns) == 0 && (strings.HasSuffix(violation.Constraint, "PRIMARY") || strings.HasSuffix(violation.Constraint, "_pkey")) {
+		columns = primaryKeyColumns[T](ctx)
+	}
+	for _, column := range columns {
+		if field := sch.LookUpField(column); field != nil {
+			violation.Fields = append(violation.Fields, jsonFieldName(field))
+		}
+	}
+
+	// without columns, guess the field from the constraint name, e.g.
+	// "users_email_key" or "idx_users_email"
+	if len(columns) == 0 && violation.Constraint != "" {
+		var best *schema.Field
+		for _, field := range sch.Fields {
+			if field.DBName != "" && strings.Contains(violation.Constraint, field.DBName) && (best == nil || len(field.DBName) > len(best.DBName)) {
+				best = field
+			}
+		}
+		if best != nil {
+			violation.Fields = []string{jsonFieldName(best)}
+		}
+	}
+	return violation
+}
@@ -0,0 +1,89 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type pgError struct {
+	Message    string
+	Code       string
+	Detail     string
+	ColumnName string
+}
+
+func (e *pgError) Error() string {
+	return "ERROR: " + e.Message + " (SQLSTATE " + e.Code + ")"
+}
+
+func TestParseConstraintError(t *testing.T) {
+	cases := []struct {
+		err        error
+		constraint string
+		name       string
+		columns    []string
+	}{
+		// SQLite
+		{errors.New("UNIQUE constraint failed: stock_models.tenant_id, stock_models.sku"), ConstraintUnique, "", []string{"tenant_id", "sku"}},
+		{errors.New("FOREIGN KEY constraint failed"), ConstraintForeignKey, "", nil},
+		{errors.New("NOT NULL constraint failed: users.name"), ConstraintNotNull, "", []string{"name"}},
+		{errors.New("CHECK constraint failed: age_positive"), ConstraintCheck, "age_positive", nil},
+		// Postgres
+		{&pgError{Message: `duplicate key value violates unique constraint "users_email_key"`, Code: "23505", Detail: "Key (email)=(a@b.c) already exists."}, ConstraintUnique, "users_email_key", []string{"email"}},
+		{errors.New(`pq: insert or update on table "orders" violates foreign key constraint "orders_user_id_fkey"`), ConstraintForeignKey, "orders_user_id_fkey", nil},
+		{&pgError{Message: `null value in column "name" of relation "users" violates not-null constraint`, Code: "23502", ColumnName: "name"}, ConstraintNotNull, "", []string{"name"}},
+		{errors.New(`ERROR: new row for relation "users" violates check constraint "age_positive" (SQLSTATE 23514)`), ConstraintCheck, "age_positive", nil},
+		// MySQL
+		{errors.New("Error 1062 (23000): Duplicate entry 'a@b.c' for key 'users.idx_users_email'"), ConstraintUnique, "users.idx_users_email", nil},
+		{errors.New("Error 1452: Cannot add or update a child row: a foreign key constraint fails (`shop`.`orders`, CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"), ConstraintForeignKey, "", []string{"user_id"}},
+		{errors.New("Error 1048: Column 'name' cannot be null"), ConstraintNotNull, "", []string{"name"}},
+		{errors.New("Error 3819: Check constraint 'age_positive' is violated."), ConstraintCheck, "age_positive", nil},
+	}
+
+	for _, c := range cases {
+		violation, columns := parseConstraintError(c.err)
+		if violation == nil {
+			t.Errorf("%v: not recognised", c.err)
+			continue
+		}
+		if violation.Type != c.constraint || violation.Constraint != c.name || !reflect.DeepEqual(columns, c.columns) {
+			t.Errorf("%v: got %v %q %v", c.err, violation.Type, violation.Constraint, columns)
+		}
+	}
+
+	if violation, _ := parseConstraintError(errors.New("connection refused")); violation != nil {
+		t.Errorf("expected other errors to pass through, got %v", violation)
+	}
+}
+
+func TestConstraintErrorKinds(t *testing.T) {
+	cases := []struct {
+		constraint string
+		kind       error
+		message    string
+	}{
+		{ConstraintUnique, ErrConflict, "duplicate value for: email"},
+		{ConstraintNotNull, ErrConflict, "missing value for: email"},
+		{ConstraintCheck, ErrConflict, "check constraint violated for: email"},
+		{ConstraintForeignKey, ErrUnprocessable, "invalid reference for: email"},
+	}
+	for _, c := range cases {
+		violation := &ConstraintError{Type: c.constraint, Fields: []string{"email"}}
+		other := ErrUnprocessable
+		if c.kind == ErrUnprocessable {
+			other = ErrConflict
+		}
+		if !errors.Is(violation, c.kind) || errors.Is(violation, other) || violation.Error() != c.message {
+			t.Errorf("%v: expected %v %q, got %v", c.constraint, c.kind, c.message, violation)
+		}
+	}
+
+	r := NewMemoryRepository[stockModel]()
+	_, _ = r.Create(ctx, stockModel{TenantId: "acme", Sku: "a"})
+	_, err := r.Create(ctx, stockModel{TenantId: "acme", Sku: "a"})
+	var violation *ConstraintError
+	if !errors.As(err, &violation) || !reflect.DeepEqual(violation.Fields, []string{"tenantId", "sku"}) {
+		t.Errorf("expected a duplicate key violation, got %v", err)
+	}
+}
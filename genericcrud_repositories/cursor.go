@@ -0,0 +1,282 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrInvalidCursor = withKind(ErrValidation, errors.New("invalid cursor"))
+
+var (
+	cursorSecretMu sync.RWMutex
+	cursorSecret   = randomCursorSecret()
+)
+
+func randomCursorSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate cursor secret: %v", err))
+	}
+	return secret
+}
+
+// SetCursorSecret sets the key cursors are signed with. Without it a random
+// key is used, so cursors are only valid within the process that issued them;
+// services running more than one instance must share a secret.
+func SetCursorSecret(secret []byte) {
+	cursorSecretMu.Lock()
+	defer cursorSecretMu.Unlock()
+	cursorSecret = secret
+}
+
+// cursor is the position of a row within a sorted collection. It holds the
+// values of the sort keys followed by the id of the row.
+type cursor struct {
+	Sort     string            `json:"s"`
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload)), nil
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return c, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signCursor(payload)) {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func signCursor(payload []byte) []byte {
+	cursorSecretMu.RLock()
+	mac := hmac.New(sha256.New, cursorSecret)
+	cursorSecretMu.RUnlock()
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// keysetFields are the columns a cursor seeks on: the sort keys with the
+// primary key columns as the final tie breakers.
+func keysetFields[T any](ctx context.Context, sort string) ([]SortField, error) {
+	fields, err := ParseSort[T](sort)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := map[string]bool{}
+	for _, f := range fields {
+		sorted[f.Column] = true
+	}
+	for _, key := range primaryKeyColumns[T](ctx) {
+		if !sorted[key] {
+			fields = append(fields, SortField{Field: utils.ToCamelCaseLower(key), Column: key})
+		}
+	}
+	return fields, nil
+}
+
+// ValidatePagination checks the sort expression, filters and cursor of a list
+// request without running any query.
+func ValidatePagination[T any](pagination Pagination) error {
+	return validatePagination[T](context.Background(), pagination)
+}
+
+func validatePagination[T any](ctx context.Context, pagination Pagination) error {
+	fields, err := keysetFields[T](ctx, pagination.Sort)
+	if err != nil {
+		return err
+	}
+
+	if err := ValidateFilters[T](pagination.Filters); err != nil {
+		return err
+	}
+
+	if err := validateSearch[T](pagination); err != nil {
+		return err
+	}
+
+	if pagination.Cursor == "" {
+		return nil
+	}
+
+	c, err := decodeCursor(pagination.Cursor)
+	if err != nil {
+		return err
+	}
+	if c.Sort != pagination.Sort || len(c.Values) != len(fields) {
+		return fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidCursor)
+	}
+	return nil
+}
+
+// keysetCondition selects the rows after (or before, when seeking backward)
+// the position held by values.
+func keysetCondition(fields []SortField, values []interface{}, backward bool) clause.Expression {
+	var ors []clause.Expression
+	for i, f := range fields {
+		var ands []clause.Expression
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: clause.Column{Name: fields[j].Column}, Value: values[j]})
+		}
+
+		column := clause.Column{Name: f.Column}
+		if f.Desc != backward {
+			ands = append(ands, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	return clause.Or(ors...)
+}
+
+// cursorValues decodes the values of a cursor into the go types of the
+// columns they belong to, so that they compare correctly in the database.
+func cursorValues(sch *schema.Schema, fields []SortField, c cursor) ([]interface{}, error) {
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		field := sch.LookUpField(f.Column)
+		if field == nil {
+			return nil, fmt.Errorf("%w: unknown column: %v", ErrInvalidCursor, f.Column)
+		}
+
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+func rowCursor[T any](sch *schema.Schema, fields []SortField, sort string, row T, backward bool) (string, error) {
+	c := cursor{Sort: sort, Backward: backward}
+	rv := reflect.ValueOf(&row).Elem()
+	for _, f := range fields {
+		field := sch.LookUpField(f.Column)
+		if field == nil {
+			return "", fmt.Errorf("unknown column: %v", f.Column)
+		}
+
+		value, _ := field.ValueOf(context.Background(), rv)
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, raw)
+	}
+	return encodeCursor(c)
+}
+
+// findCursorPage loads the page of rows next to the cursor of the pagination.
+// No count is run: seeking is meant for tables too large to count cheaply.
+func findCursorPage[T any](ctx context.Context, query *gorm.DB, pagination Pagination, preloads ...string) (Page[T], error) {
+	var all []T
+	n := pagination.Normalized()
+	page := Page[T]{Rows: all, Total: -1, Limit: n.Limit}
+
+	if err := validatePagination[T](ctx, pagination); err != nil {
+		return page, err
+	}
+	fields, _ := keysetFields[T](ctx, pagination.Sort)
+	c, _ := decodeCursor(pagination.Cursor)
+
+	sch, err := parseSchema[T](query)
+	if err != nil {
+		return page, err
+	}
+	values, err := cursorValues(sch, fields, c)
+	if err != nil {
+		return page, err
+	}
+
+	instance := query.Session(&gorm.Session{}).Where(keysetCondition(fields, values, c.Backward))
+	for _, f := range fields {
+		instance = instance.Order(clause.OrderByColumn{
+			Column: clause.Column{Name: f.Column},
+			Desc:   f.Desc != c.Backward,
+		})
+	}
+
+	instance, err = projected[T](ctx, instance, pagination.Sort, preloads...)
+	if err != nil {
+		return page, err
+	}
+
+	result := instance.Limit(n.Limit + 1).Find(&all)
+	if result.Error != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", modelType[T]().Name(), result.Error))
+		return page, result.Error
+	}
+
+	more := len(all) > n.Limit
+	if more {
+		all = all[:n.Limit]
+	}
+	if c.Backward {
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+		page.HasPrev, page.HasNext = more, true
+	} else {
+		page.HasNext, page.HasPrev = more, true
+	}
+
+	page.Rows = all
+	return withCursors(sch, fields, pagination.Sort, page)
+}
+
+// withCursors sets the cursors of the rows at both ends of the page.
+func withCursors[T any](sch *schema.Schema, fields []SortField, sort string, page Page[T]) (Page[T], error) {
+	if len(page.Rows) == 0 {
+		return page, nil
+	}
+
+	var err error
+	if page.HasNext {
+		if page.NextCursor, err = rowCursor(sch, fields, sort, page.Rows[len(page.Rows)-1], false); err != nil {
+			return page, err
+		}
+	}
+	if page.HasPrev {
+		if page.PrevCursor, err = rowCursor(sch, fields, sort, page.Rows[0], true); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
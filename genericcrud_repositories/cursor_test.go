@@ -0,0 +1,90 @@
+package genericcrud_repositories_gorm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	encoded, err := encodeCursor(cursor{Sort: "-name", Values: []json.RawMessage{[]byte(`"x"`), []byte(`7`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeCursor(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Sort != "-name" || len(decoded.Values) != 2 || string(decoded.Values[1]) != "7" {
+		t.Errorf("unexpected cursor: %+v", decoded)
+	}
+}
+
+func TestCursorRejectsTampering(t *testing.T) {
+	encoded, _ := encodeCursor(cursor{Values: []json.RawMessage{[]byte(`1`)}})
+	forged, _ := encodeCursor(cursor{Values: []json.RawMessage{[]byte(`"1 OR 1=1"`)}})
+
+	tampered := forged[:len(forged)-43] + encoded[len(encoded)-43:]
+	for _, c := range []string{tampered, "abc", encoded + "x"} {
+		if _, err := decodeCursor(c); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("expected %q to be rejected, got %v", c, err)
+		}
+	}
+}
+
+type queuedJob struct {
+	Id       uint   `gorm:"primaryKey" json:"id"`
+	Priority int    `json:"priority"`
+	Queue    string `json:"queue"`
+}
+
+func TestCursorPagesBreakTies(t *testing.T) {
+	SetSortableFields[queuedJob]("priority", "queue")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&queuedJob{}); err != nil {
+		t.Fatal(err)
+	}
+	// ties on the priority, and on the priority and the queue, are broken by id
+	var jobs []queuedJob
+	for _, job := range []string{"2b", "1a", "2a", "2b", "1a", "2b", "1b", "2a"} {
+		jobs = append(jobs, queuedJob{Priority: int(job[0] - '0'), Queue: job[1:]})
+	}
+	db.Create(&jobs)
+
+	list := func(cursor string) Page[queuedJob] {
+		t.Helper()
+		page, err := GetAll[queuedJob](ctx, db, Pagination{Limit: 3, Sort: "-priority,queue", Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+	ids := func(page Page[queuedJob]) string {
+		var result []uint
+		for _, row := range page.Rows {
+			result = append(result, row.Id)
+		}
+		return fmt.Sprint(result)
+	}
+
+	first := list("")
+	second := list(first.NextCursor)
+	third := list(second.NextCursor)
+	if got := ids(first) + ids(second) + ids(third); got != "[3 8 1][4 6 2][5 7]" {
+		t.Errorf("unexpected pages: %v", got)
+	}
+	if second.Total != -1 || !second.HasPrev || !second.HasNext || third.HasNext {
+		t.Errorf("unexpected page metadata: %+v %+v", second, third)
+	}
+	if back := list(third.PrevCursor); ids(back) != ids(second) || !back.HasPrev {
+		t.Errorf("expected to page back to the second page, got %v %+v", ids(back), back)
+	}
+
+	// a row sorted before the cursor does not shift the pages after it
+	db.Create(&queuedJob{Priority: 2, Queue: "a"})
+	if next := list(first.NextCursor); ids(next) != ids(second) {
+		t.Errorf("expected the second page to stay, got %v", ids(next))
+	}
+}
@@ -0,0 +1,53 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// The kinds of errors the functions of this package return. The more specific
+// errors, e.g. ErrInvalidPatch or a VersionConflictError, match one of these
+// with errors.Is, so callers can tell failures apart by kind alone.
+var (
+	ErrNotFound           = errors.New("record not found")
+	ErrConflict           = errors.New("conflict")
+	ErrValidation         = errors.New("validation failed")
+	ErrForbidden          = errors.New("forbidden")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnprocessable      = errors.New("unprocessable entity")
+)
+
+// kindError gives err the kind of one of the errors above while keeping its
+// message and chain.
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// withKind makes err match kind with errors.Is. It returns nil for a nil err.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{err: err, kind: kind}
+}
+
+// notFound is the error for a missing row of T. It matches both ErrNotFound
+// and gorm.ErrRecordNotFound.
+func notFound[T any](id string) error {
+	return withKind(ErrNotFound, fmt.Errorf("%w: %v with id: %v", gorm.ErrRecordNotFound, modelType[T]().Name(), id))
+}
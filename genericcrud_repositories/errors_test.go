@@ -0,0 +1,41 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestErrorKinds(t *testing.T) {
+	r := NewMemoryRepository[memoryModel]()
+	_, err := r.GetOneById(ctx, "missing")
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if _, err := r.UpdateById(ctx, memoryModel{Name: "x"}, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected updating a missing row to be not found, got %v", err)
+	}
+
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{fmt.Errorf("%w: bad", ErrInvalidPatch), ErrValidation},
+		{ErrEmptyFilter, ErrValidation},
+		{ErrInvalidCursor, ErrValidation},
+		{ValidateFilters[memoryHardModel](Filters{{Field: "name", Operator: FilterEq}}), ErrValidation},
+		{&VersionConflictError{Expected: 1, Actual: 2}, ErrConflict},
+		{&VersionConflictError{Expected: 1, Actual: 2, Precondition: true}, ErrPreconditionFailed},
+	}
+	for _, c := range cases {
+		if !errors.Is(c.err, c.kind) {
+			t.Errorf("expected %v to match %v", c.err, c.kind)
+		}
+	}
+
+	if errors.Is(&VersionConflictError{Precondition: true}, ErrConflict) {
+		t.Error("expected a failed precondition not to match ErrConflict")
+	}
+}
@@ -0,0 +1,305 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Fieldset is a sparse fieldset: the json fields of a model a read returns,
+// and those of the relations preloaded with it keyed by the json name of the
+// relation. Without Fields every field of the model is returned.
+type Fieldset struct {
+	Fields    []string            `json:"fields"`
+	Relations map[string][]string `json:"relations"`
+}
+
+func (f Fieldset) Empty() bool {
+	return len(f.Fields) == 0 && len(f.Relations) == 0
+}
+
+var fieldsParam = regexp.MustCompile(`^fields\[([^\[\]]+)\]$`)
+
+// ParseFieldset reads a sparse fieldset written as fields=id,name and
+// fields[relation]=id,title from a query string. Every name must be a json
+// field of T, or of the relation for fields[relation]; a relation given its
+// own fields is returned even when fields does not list it.
+func ParseFieldset[T any](query url.Values) (Fieldset, error) {
+	var fieldset Fieldset
+	for key, values := range query {
+		if key == "fields" {
+			fields, err := fieldNames(modelType[T](), values)
+			if err != nil {
+				return Fieldset{}, err
+			}
+			fieldset.Fields = fields
+			continue
+		}
+		if !strings.HasPrefix(key, "fields[") {
+			continue
+		}
+
+		match := fieldsParam.FindStringSubmatch(key)
+		if match == nil {
+			return Fieldset{}, withKind(ErrValidation, fmt.Errorf("invalid fieldset: %v", key))
+		}
+		relation, index, ok := jsonField(modelType[T](), match[1])
+		if !ok || elementType(modelType[T](), index).Kind() != reflect.Struct {
+			return Fieldset{}, withKind(ErrValidation, fmt.Errorf("%v has no relation: %v", modelType[T]().Name(), match[1]))
+		}
+		fields, err := fieldNames(elementType(modelType[T](), index), values)
+		if err != nil {
+			return Fieldset{}, err
+		}
+		if fieldset.Relations == nil {
+			fieldset.Relations = map[string][]string{}
+		}
+		fieldset.Relations[relation] = fields
+	}
+
+	if len(fieldset.Fields) > 0 {
+		for relation := range fieldset.Relations {
+			if !contains(fieldset.Fields, relation) {
+				fieldset.Fields = append(fieldset.Fields, relation)
+			}
+		}
+	}
+	return fieldset, nil
+}
+
+// fieldNames splits comma separated field names and returns the json names of
+// the fields of t they refer to.
+func fieldNames(t reflect.Type, values []string) ([]string, error) {
+	var fields []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			field, _, ok := jsonField(t, name)
+			if name == "" || !ok {
+				return nil, withKind(ErrValidation, fmt.Errorf("%v has no field: %q", t.Name(), name))
+			}
+			if !contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonName is the key field is serialized under by encoding/json.
+func jsonName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// jsonField finds the field of t serialized under name, looking into embedded
+// structs, and returns its json name. Names are matched regardless of case.
+func jsonField(t reflect.Type, name string) (string, []int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || jsonName(f) == "-" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			if field, index, ok := jsonField(f.Type, name); ok {
+				return field, append([]int{i}, index...), true
+			}
+			continue
+		}
+
+		if utils.ToCamelCaseLower(jsonName(f)) == utils.ToCamelCaseLower(name) {
+			return jsonName(f), []int{i}, true
+		}
+	}
+	return "", nil, false
+}
+
+// elementType is the type held by the field of t at index, through pointers
+// and slices.
+func elementType(t reflect.Type, index []int) reflect.Type {
+	element := t.FieldByIndex(index).Type
+	for element.Kind() == reflect.Ptr || element.Kind() == reflect.Slice {
+		element = element.Elem()
+	}
+	return element
+}
+
+type fieldsetKey struct{}
+
+// WithFieldset restricts the reads done within ctx to the fields of fieldset.
+func WithFieldset(ctx context.Context, fieldset Fieldset) context.Context {
+	return context.WithValue(ctx, fieldsetKey{}, fieldset)
+}
+
+func FieldsetFromContext(ctx context.Context) (Fieldset, bool) {
+	fieldset, ok := ctx.Value(fieldsetKey{}).(Fieldset)
+	return fieldset, ok && !fieldset.Empty()
+}
+
+// projected loads the given preloads with a read of T and, when the context
+// of databaseInstance carries a fieldset, only selects the requested columns.
+// The primary key, version and sort columns of T and the keys joining the
+// preloaded relations are always selected.
+func projected[T any](ctx context.Context, databaseInstance *gorm.DB, sort string, preloads ...string) (*gorm.DB, error) {
+	fieldset, ok := FieldsetFromContext(databaseInstance.Statement.Context)
+	if !ok {
+		return preloadsHandler(databaseInstance, preloads...), nil
+	}
+
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fieldset.Fields) > 0 {
+		columns := append([]string{}, primaryKeyColumns[T](ctx)...)
+		if column := versionColumn[T](); column != "" {
+			columns = append(columns, column)
+		}
+		sortFields, err := keysetFields[T](ctx, sort)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range sortFields {
+			columns = append(columns, f.Column)
+		}
+		requested, err := fieldColumns(sch, fieldset.Fields)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, requested...)
+		for _, preload := range preloads {
+			if relation, ok := sch.Relationships.Relations[strings.Split(preload, ".")[0]]; ok {
+				columns = append(columns, referenceColumns(sch, relation)...)
+			}
+		}
+		databaseInstance = databaseInstance.Select(unique(columns))
+	}
+
+	for _, preload := range preloads {
+		relation, ok := sch.Relationships.Relations[preload]
+		if !ok {
+			databaseInstance = databaseInstance.Preload(preload)
+			continue
+		}
+		fields := fieldset.Relations[jsonName(relation.Field.StructField)]
+		if len(fields) == 0 {
+			databaseInstance = databaseInstance.Preload(preload)
+			continue
+		}
+
+		requested, err := fieldColumns(relation.FieldSchema, fields)
+		if err != nil {
+			return nil, err
+		}
+		columns := append(append(append([]string{}, relation.FieldSchema.PrimaryFieldDBNames...), requested...), referenceColumns(relation.FieldSchema, relation)...)
+		databaseInstance = databaseInstance.Preload(preload, func(tx *gorm.DB) *gorm.DB {
+			return tx.Select(unique(columns))
+		})
+	}
+	return databaseInstance, nil
+}
+
+// fieldColumns maps json field names to the columns of sch; fields that are
+// not stored in a column, such as relations, are skipped.
+func fieldColumns(sch *schema.Schema, fields []string) ([]string, error) {
+	var columns []string
+	for _, name := range fields {
+		_, index, ok := jsonField(sch.ModelType, name)
+		if !ok {
+			return nil, withKind(ErrValidation, fmt.Errorf("%v has no field: %q", sch.Name, name))
+		}
+		if field := sch.LookUpField(sch.ModelType.FieldByIndex(index).Name); field != nil && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns, nil
+}
+
+// referenceColumns are the columns of sch that join relation.
+func referenceColumns(sch *schema.Schema, relation *schema.Relationship) []string {
+	var columns []string
+	for _, reference := range relation.References {
+		for _, field := range []*schema.Field{reference.PrimaryKey, reference.ForeignKey} {
+			if field != nil && field.Schema == sch && field.DBName != "" {
+				columns = append(columns, field.DBName)
+			}
+		}
+	}
+	return columns
+}
+
+func unique(values []string) []string {
+	var set []string
+	for _, v := range values {
+		if !contains(set, v) {
+			set = append(set, v)
+		}
+	}
+	return set
+}
+
+// Project returns the json of v, a row or a slice of rows, keeping only the
+// fields of the fieldset.
+func (f Fieldset) Project(v interface{}) (json.RawMessage, error) {
+	document, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return projectJSON(document, f.Fields, f.Relations)
+}
+
+func projectJSON(document json.RawMessage, fields []string, relations map[string][]string) (json.RawMessage, error) {
+	var rows []json.RawMessage
+	if json.Unmarshal(document, &rows) == nil {
+		for i, row := range rows {
+			projected, err := projectJSON(row, fields, relations)
+			if err != nil {
+				return nil, err
+			}
+			rows[i] = projected
+		}
+		return json.Marshal(rows)
+	}
+
+	var members map[string]json.RawMessage
+	if json.Unmarshal(document, &members) != nil || members == nil {
+		// null, or a value that is not a row
+		return document, nil
+	}
+
+	projected := map[string]json.RawMessage{}
+	for key, value := range members {
+		if len(fields) > 0 && !contains(fields, key) {
+			continue
+		}
+		if relationFields, ok := relations[key]; ok {
+			var err error
+			if value, err = projectJSON(value, relationFields, nil); err != nil {
+				return nil, err
+			}
+		}
+		projected[key] = value
+	}
+	return json.Marshal(projected)
+}
@@ -0,0 +1,36 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldset(t *testing.T) {
+	fieldset, err := ParseFieldset[memoryModel](url.Values{"fields": {"ID, name", "name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fieldset.Fields, []string{"id", "name"}) {
+		t.Errorf("unexpected fields: %v", fieldset.Fields)
+	}
+
+	if _, err := ParseFieldset[memoryModel](url.Values{"fields": {"id,secret"}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a validation error, got: %v", err)
+	}
+	if _, err := ParseFieldset[memoryModel](url.Values{"fields[name]": {"id"}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a validation error, got: %v", err)
+	}
+}
+
+func TestFieldsetProject(t *testing.T) {
+	fieldset := Fieldset{Fields: []string{"id", "age"}}
+	rows, err := fieldset.Project([]memoryModel{{Id: "1", Name: "ann", Age: 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rows) != `[{"age":30,"id":"1"}]` {
+		t.Errorf("unexpected projection: %s", rows)
+	}
+}
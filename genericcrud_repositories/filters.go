@@ -0,0 +1,297 @@
+package genericcrud_repositories_gorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	FilterEq      = "eq"
+	FilterNe      = "ne"
+	FilterGt      = "gt"
+	FilterGte     = "gte"
+	FilterLt      = "lt"
+	FilterLte     = "lte"
+	FilterIn      = "in"
+	FilterNin     = "nin"
+	FilterLike    = "like"
+	FilterIlike   = "ilike"
+	FilterBetween = "between"
+	FilterIsNull  = "isnull"
+)
+
+var filterOperators = map[string]bool{
+	FilterEq: true, FilterNe: true, FilterGt: true, FilterGte: true, FilterLt: true, FilterLte: true,
+	FilterIn: true, FilterNin: true, FilterLike: true, FilterIlike: true, FilterBetween: true, FilterIsNull: true,
+}
+
+// Filter is a single condition on a json field of a model, for example
+// {"field": "age", "op": "gte", "value": 18}. The values of in, nin and between
+// are either a list or a comma separated string; isnull takes true or false.
+type Filter struct {
+	Field    string      `json:"field"`
+	Operator string      `json:"op"`
+	Value    interface{} `json:"value"`
+}
+
+type Filters []Filter
+
+var filterParam = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// ParseFilters reads filters written as filter[field][op]=value from a query
+// string. filter[field]=value is short for the eq operator. Filters come in the
+// order of their keys, so that equal queries give equal SQL.
+func ParseFilters(query url.Values) (Filters, error) {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var filters Filters
+	for _, key := range keys {
+		values := query[key]
+		if !strings.HasPrefix(key, "filter[") {
+			continue
+		}
+
+		match := filterParam.FindStringSubmatch(key)
+		if match == nil {
+			return nil, withKind(ErrValidation, fmt.Errorf("invalid filter: %v", key))
+		}
+
+		operator := match[2]
+		if operator == "" {
+			operator = FilterEq
+		}
+		for _, value := range values {
+			filters = append(filters, Filter{Field: match[1], Operator: strings.ToLower(operator), Value: value})
+		}
+	}
+	return filters, nil
+}
+
+// SetFilterableFields registers the json field names T may be filtered on.
+// Filtering on any other field is rejected.
+func SetFilterableFields[T any](fields ...string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.filterableFields = fieldSet(fields)
+	})
+}
+
+// ValidateFilters checks the fields, operators and value counts of filters
+// against the configuration of T. Its errors match ErrValidation.
+func ValidateFilters[T any](filters Filters) error {
+	return withKind(ErrValidation, validateFilters[T](filters))
+}
+
+func validateFilters[T any](filters Filters) error {
+	allowed := getModelSettings[T]().filterableFields
+	for _, f := range filters {
+		if !allowed[utils.ToCamelCaseLower(f.Field)] {
+			return fmt.Errorf("cannot filter %v by: %v", modelType[T]().Name(), f.Field)
+		}
+		if !filterOperators[f.Operator] {
+			return fmt.Errorf("unknown filter operator: %v", f.Operator)
+		}
+
+		switch f.Operator {
+		case FilterBetween:
+			if len(filterValues(f.Value)) != 2 {
+				return fmt.Errorf("between filter on %v needs two values", f.Field)
+			}
+		case FilterIn, FilterNin:
+			if len(filterValues(f.Value)) == 0 {
+				return fmt.Errorf("%v filter on %v needs at least one value", f.Operator, f.Field)
+			}
+		case FilterIsNull:
+			if _, err := isNullValue(f.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func filterValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case string:
+		var values []interface{}
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []interface{}:
+		return v
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice {
+		values := make([]interface{}, rv.Len())
+		for i := range values {
+			values[i] = rv.Index(i).Interface()
+		}
+		return values
+	}
+	return []interface{}{value}
+}
+
+func isNullValue(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "1", "":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("isnull filter takes true or false, got: %v", value)
+}
+
+// filterValue converts a value to the go type of the field it is compared
+// with, so that strings read from a query string bind as numbers, times, etc.
+func filterValue(field *schema.Field, value interface{}) (interface{}, error) {
+	converted, err := convertValue(field.FieldType, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %v: %v", field.Name, value)
+	}
+	return converted, nil
+}
+
+// convertValue converts strings to fieldType, dereferencing pointer types.
+// Values of any other type are returned as they are.
+func convertValue(fieldType reflect.Type, value interface{}) (interface{}, error) {
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	if fieldType.Kind() == reflect.String {
+		return reflect.ValueOf(s).Convert(fieldType).Interface(), nil
+	}
+
+	target := reflect.New(fieldType)
+	if err := json.Unmarshal([]byte(s), target.Interface()); err != nil {
+		quoted, _ := json.Marshal(s)
+		if err := json.Unmarshal(quoted, target.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return target.Elem().Interface(), nil
+}
+
+// filterExpression turns a validated filter into a parameterized condition.
+func filterExpression(sch *schema.Schema, f Filter) (clause.Expression, error) {
+	columnName := utils.ToSnakeCase(utils.ToCamelCaseLower(f.Field))
+	field := sch.LookUpField(columnName)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("%v has no column for: %v", sch.Name, f.Field)
+	}
+	column := clause.Column{Name: field.DBName}
+
+	convert := func(values []interface{}) ([]interface{}, error) {
+		converted := make([]interface{}, len(values))
+		for i, v := range values {
+			c, err := filterValue(field, v)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = c
+		}
+		return converted, nil
+	}
+
+	switch f.Operator {
+	case FilterIsNull:
+		isNull, err := isNullValue(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		if isNull {
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}}, nil
+		}
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}, nil
+	case FilterLike:
+		return clause.Like{Column: column, Value: fmt.Sprint(f.Value)}, nil
+	case FilterIlike:
+		return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?)", Vars: []interface{}{column, fmt.Sprint(f.Value)}}, nil
+	case FilterIn, FilterNin, FilterBetween:
+		values, err := convert(filterValues(f.Value))
+		if err != nil {
+			return nil, err
+		}
+		switch f.Operator {
+		case FilterIn:
+			return clause.IN{Column: column, Values: values}, nil
+		case FilterNin:
+			return clause.Not(clause.IN{Column: column, Values: values}), nil
+		}
+		if len(values) != 2 {
+			return nil, fmt.Errorf("between filter on %v needs two values", f.Field)
+		}
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{column, values[0], values[1]}}, nil
+	}
+
+	value, err := filterValue(field, f.Value)
+	if err != nil {
+		return nil, err
+	}
+	switch f.Operator {
+	case FilterEq:
+		return clause.Eq{Column: column, Value: value}, nil
+	case FilterNe:
+		return clause.Neq{Column: column, Value: value}, nil
+	case FilterGt:
+		return clause.Gt{Column: column, Value: value}, nil
+	case FilterGte:
+		return clause.Gte{Column: column, Value: value}, nil
+	case FilterLt:
+		return clause.Lt{Column: column, Value: value}, nil
+	case FilterLte:
+		return clause.Lte{Column: column, Value: value}, nil
+	}
+	return nil, fmt.Errorf("unknown filter operator: %v", f.Operator)
+}
+
+func filtersHandler[T any](databaseInstance *gorm.DB, filters Filters) (*gorm.DB, error) {
+	if len(filters) == 0 {
+		return databaseInstance, nil
+	}
+
+	if err := ValidateFilters[T](filters); err != nil {
+		return databaseInstance, err
+	}
+
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return databaseInstance, err
+	}
+
+	instance := databaseInstance
+	for _, f := range filters {
+		expression, err := filterExpression(sch, f)
+		if err != nil {
+			return databaseInstance, withKind(ErrValidation, err)
+		}
+		instance = instance.Where(expression)
+	}
+	return instance, nil
+}
@@ -0,0 +1,71 @@
+package genericcrud_repositories_gorm
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type filteredModel struct {
+	Id     string `json:"id"`
+	Age    int    `json:"age"`
+	Status string `json:"status"`
+}
+
+func TestParseFilters(t *testing.T) {
+	query, _ := url.ParseQuery("filter[age][gte]=18&filter[status][in]=active,pending&filter[status]=x&page=2")
+
+	filters, err := ParseFilters(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 3 {
+		t.Fatalf("expected 3 filters, got %+v", filters)
+	}
+
+	byOperator := map[string]Filter{}
+	for _, f := range filters {
+		byOperator[f.Operator] = f
+	}
+	if f := byOperator[FilterGte]; f.Field != "age" || f.Value != "18" {
+		t.Errorf("unexpected gte filter: %+v", f)
+	}
+	if f := byOperator[FilterEq]; f.Field != "status" || f.Value != "x" {
+		t.Errorf("unexpected eq filter: %+v", f)
+	}
+	for i := 0; i < 10; i++ {
+		again, _ := ParseFilters(query)
+		if !reflect.DeepEqual(again, filters) || filters[0].Operator != FilterGte || filters[2].Operator != FilterIn {
+			t.Fatalf("expected filters in the order of their keys, got %+v", again)
+		}
+	}
+
+	if _, err := ParseFilters(url.Values{"filter[age][gte][x]": {"1"}}); err == nil {
+		t.Error("expected malformed filter to be rejected")
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	SetFilterableFields[filteredModel]("age", "status")
+
+	valid := Filters{
+		{Field: "age", Operator: FilterBetween, Value: "18,30"},
+		{Field: "status", Operator: FilterNin, Value: []interface{}{"deleted"}},
+		{Field: "status", Operator: FilterIsNull, Value: "false"},
+	}
+	if err := ValidateFilters[filteredModel](valid); err != nil {
+		t.Error(err)
+	}
+
+	for _, f := range []Filter{
+		{Field: "id", Operator: FilterEq, Value: "1"},
+		{Field: "age", Operator: "regex", Value: "1"},
+		{Field: "age", Operator: FilterBetween, Value: "18"},
+		{Field: "status", Operator: FilterIn, Value: ""},
+		{Field: "status", Operator: FilterIsNull, Value: "maybe"},
+	} {
+		if err := ValidateFilters[filteredModel](Filters{f}); err == nil {
+			t.Errorf("expected %+v to be rejected", f)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package genericcrud_repositories_gorm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/danielcomboni/generic-crud/utils"
@@ -10,75 +11,103 @@ import (
 	"github.com/gobeam/stringy"
 	"github.com/mitchellh/mapstructure"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type Pagination struct {
-	Limit int    `json:"limit"`
-	Page  int    `json:"page"`
-	Sort  string `json:"sort"`
+// Create inserts model, running the create hooks of T around the insert.
+func Create[T any](ctx context.Context, model *T, databaseInstance *gorm.DB) (T, error) {
+	return withHooks[T](ctx, databaseInstance, AuditCreate, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		return nil, model, nil
+	}, func(ctx context.Context, tx *gorm.DB) (T, *T, error) {
+		created, err := create[T](ctx, model, tx)
+		return created, &created, err
+	})
 }
 
-var tablePagination *Pagination
-
-func SetPagination(limit, page int, sort string) {
-	tablePagination = &Pagination{
-		Limit: limit,
-		Page:  page,
-		Sort:  sort,
-	}
-}
-
-func paginationParams() (offset int, limit int) {
-	page := tablePagination.Page
-	if page == 0 {
-		page = 1
-	}
-
-	pageSize := tablePagination.Limit
-
-	switch {
-	case pageSize > 100:
-		pageSize = 100
-	case pageSize <= 0:
-		pageSize = 10
-	}
-
-	offset = (page - 1) * pageSize
-	limit = pageSize
-	return offset, pageSize
-}
-
-func Create[T any](model *T, databaseInstance *gorm.DB) (T, error) {
+func create[T any](ctx context.Context, model *T, databaseInstance *gorm.DB) (T, error) {
 	log.Print(fmt.Sprintf("\n\ncreating a new record: %v", reflect.TypeOf(*new(T)).Name()))
+	databaseInstance = connection(ctx, databaseInstance)
 	var t T
+	if err := stampTenant[T](ctx, model); err != nil {
+		log.Println(fmt.Sprintf("failed to create: %v", err))
+		return *model, err
+	}
 	result := databaseInstance.Create(&model).Scan(&t)
-	_, err := result.DB()
+	err := translateError[T](ctx, databaseInstance, result.Error)
 	if err != nil {
-		log.Panic("failed to create")
+		log.Println(fmt.Sprintf("failed to create: %v", err))
 		return *model, err
 	}
 
-	if utils.IsNullOrEmpty(utils.SafeGetFromInterface(&model, "$.id")) {
+	if !hasPrimaryKey(ctx, *model) {
 		log.Println(fmt.Sprintf("not saved:"))
 		return *model, err
 	}
 
 	if result.RowsAffected > 0 {
-		log.Println(fmt.Sprintf("saved to database: id: %v", utils.SafeGetFromInterface(t, "$.id")))
+		log.Println(fmt.Sprintf("saved to database: id: %v", idOf(ctx, *model)))
 	}
 	//t := utils.SafeGetFromInterfaceGenericAndDeserialize[T](&model, "$")
 	return t, nil
 }
 
-func CreateBatch[T any](models []T, databaseInstance *gorm.DB) ([]T, error) {
+// CreateBatch inserts models in one statement, running the create hooks of T
+// around the insert for each of them.
+func CreateBatch[T any](ctx context.Context, models []T, databaseInstance *gorm.DB) ([]T, error) {
+	ctx = transactionContext(ctx, databaseInstance)
+	defer invalidate[T](ctx)
+
+	if !hasHooks[T](hookCreate) && !audited[T]() {
+		return createBatch[T](ctx, models, databaseInstance)
+	}
+
+	var created []T
+	err := WithTransaction(ctx, databaseInstance, func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		for i := range models {
+			if err := runHooks[T](ctx, hookCreate, false, nil, &models[i]); err != nil {
+				return err
+			}
+		}
+
+		rows, err := createBatch[T](ctx, models, tx)
+		if err != nil {
+			return err
+		}
+
+		for i := range rows {
+			if err := runHooks[T](ctx, hookCreate, true, nil, &rows[i]); err != nil {
+				return err
+			}
+			if err := audit[T](ctx, tx, AuditCreate, nil, &rows[i]); err != nil {
+				return err
+			}
+		}
+		created = rows
+		return nil
+	})
+	return created, err
+}
+
+func createBatch[T any](ctx context.Context, models []T, databaseInstance *gorm.DB) ([]T, error) {
 	log.Println(fmt.Sprintf("\n\ncreating a new record: %v", reflect.TypeOf(*new(T)).Name()))
+	databaseInstance = connection(ctx, databaseInstance)
 	var t []T
-	result := databaseInstance.Create(&models).Scan(&t)
-	_, err := result.DB()
+	for i := range models {
+		if err := stampTenant[T](ctx, &models[i]); err != nil {
+			log.Println(fmt.Sprintf("failed to create in batch: %v", err))
+			return t, err
+		}
+	}
+	// the rows come back from models, filled in by the insert; a Scan would
+	// select every row of the table
+	result := databaseInstance.Create(&models)
+	err := translateError[T](ctx, databaseInstance, result.Error)
 	if err != nil {
 		log.Println("failed to create in batch")
 		return t, err
 	}
+	t = models
 
 	if len(t) == 0 {
 		log.Println(fmt.Sprintf("not saved:"))
@@ -86,24 +115,84 @@ func CreateBatch[T any](models []T, databaseInstance *gorm.DB) ([]T, error) {
 	}
 
 	if result.RowsAffected > 0 {
-		log.Println(fmt.Sprintf("saved to database: id: %v", utils.SafeGetFromInterface(t, "$.id")))
+		log.Println(fmt.Sprintf("saved to database: rows: %v", len(t)))
 	}
 	//t := utils.SafeGetFromInterfaceGenericAndDeserialize[T](&model, "$")
 	return t, nil
 }
 
-func GetAll[T any](databaseInstance *gorm.DB) ([]T, error) {
+func GetAll[T any](ctx context.Context, databaseInstance *gorm.DB, pagination Pagination) (Page[T], error) {
 	log.Println(fmt.Sprintf("\n\nretreiving collection: %v", reflect.TypeOf(*new(T)).Name()))
+	ctx = transactionContext(ctx, databaseInstance)
+	return cachedPage[T](ctx, databaseInstance, pagination, nil, nil, func() (Page[T], error) {
+		databaseInstance, err := scoped[T](ctx, databaseInstance)
+		if err != nil {
+			return newPage([]T{}, 0, pagination), err
+		}
+		return findPage[T](ctx, databaseInstance.Model(new(T)), pagination)
+	})
+}
+
+// findPage counts the rows matched by query and then loads the requested page
+// of them. The count and the page share the same conditions.
+func findPage[T any](ctx context.Context, query *gorm.DB, pagination Pagination, preloads ...string) (Page[T], error) {
+	query, err := filtersHandler[T](query, pagination.Filters)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to filter: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return newPage([]T{}, 0, pagination), err
+	}
+
+	query, rank, err := searchHandler[T](ctx, query, pagination)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to search: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return newPage([]T{}, 0, pagination), err
+	}
+	var ranks []clause.Expression
+	if rank != nil {
+		ranks = append(ranks, rank)
+	}
+
+	if pagination.Cursor != "" {
+		return findCursorPage[T](ctx, query, pagination, preloads...)
+	}
+
 	var all []T
-	offset, limit := paginationParams()
+	offset, limit := pagination.params()
 	log.Println(fmt.Sprintf("offset: %v, limit: %v", offset, limit))
-	result := databaseInstance.Offset(offset).Limit(limit).Find(&all)
-	_, err := result.DB()
+
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	counted := query.Count(&total)
+	if counted.Error != nil {
+		log.Println(fmt.Sprintf("failed to count: %v %v", reflect.TypeOf(*new(T)).Name(), counted.Error))
+		return newPage(all, 0, pagination), counted.Error
+	}
+
+	sorted, err := sortHandler[T](query, pagination.Sort, ranks...)
 	if err != nil {
-		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
-		return all, err
+		log.Println(fmt.Sprintf("failed to sort: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return newPage(all, total, pagination), err
+	}
+
+	instance, err := projected[T](ctx, sorted, pagination.Sort, preloads...)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to select fields: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return newPage(all, total, pagination), err
 	}
-	return all, nil
+
+	result := instance.Offset(offset).Limit(limit).Find(&all)
+	if result.Error != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), result.Error))
+		return newPage(all, total, pagination), result.Error
+	}
+
+	sch, err := parseSchema[T](query)
+	if err != nil {
+		return newPage(all, total, pagination), err
+	}
+	fields, _ := keysetFields[T](ctx, pagination.Sort)
+	return withCursors(sch, fields, pagination.Sort, newPage(all, total, pagination))
 }
 
 func preloadsHandler(databaseInstance *gorm.DB, preloads ...string) *gorm.DB {
@@ -129,130 +218,231 @@ func omitsHandler(databaseInstance *gorm.DB, omits ...string) *gorm.DB {
 	return instance
 }
 
-func GetAllByFields[T any](databaseInstance *gorm.DB, queryMap map[string]interface{}, preloads ...string) ([]T, error) {
+func GetAllByFields[T any](ctx context.Context, databaseInstance *gorm.DB, pagination Pagination, queryMap map[string]interface{}, preloads ...string) (Page[T], error) {
 	log.Println(fmt.Sprintf("retreiving collection: %v\n", reflect.TypeOf(*new(T)).Name()))
-	var all []T
-	offset, limit := paginationParams()
-	log.Println(fmt.Sprintf("offset: %v, limit: %v", offset, limit))
+	ctx = transactionContext(ctx, databaseInstance)
+	return cachedPage[T](ctx, databaseInstance, pagination, queryMap, preloads, func() (Page[T], error) {
+		databaseInstance, err := scoped[T](ctx, databaseInstance)
+		if err != nil {
+			return newPage([]T{}, 0, pagination), err
+		}
+		return findPage[T](ctx, databaseInstance.Model(new(T)).Where(queryMap), pagination, preloads...)
+	})
+}
 
-	var instance *gorm.DB
+// GetOneById returns the row of T with the given id, from the cache of T when
+// it has one.
+func GetOneById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, preloads ...string) (T, error) {
+	ctx = transactionContext(ctx, databaseInstance)
+	return cachedRow[T](ctx, databaseInstance, id, preloads, func() (T, error) {
+		return getOneById[T](ctx, databaseInstance, id, preloads...)
+	})
+}
 
-	if len(preloads) == 0 {
-		instance = databaseInstance.Offset(offset).Limit(limit).Where(queryMap).Find(&all)
-	} else {
-		instance = preloadsHandler(databaseInstance, preloads...).Offset(offset).Limit(limit).Where(queryMap).Find(&all)
+func getOneById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, preloads ...string) (T, error) {
+	log.Println(fmt.Sprintf("\n\nretreiving single row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
+	var row T
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, err
 	}
 
-	result := instance
-	_, err := result.DB()
+	condition, err := byId[T](ctx, id)
 	if err != nil {
 		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
-		return all, err
+		return row, err
 	}
-	return all, nil
-}
-
-func GetOneById[T any](databaseInstance *gorm.DB, id string, preloads ...string) (T, error) {
-	log.Println(fmt.Sprintf("\n\nretreiving single row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
-	var row T
 
-	var instance *gorm.DB
-	if len(preloads) == 0 {
-		instance = databaseInstance.Where("id=?", id).Find(&row)
-	} else {
-		instance = preloadsHandler(databaseInstance, preloads...).Where("id=?", id).Find(&row)
+	instance, err := projected[T](ctx, databaseInstance, "", preloads...)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, err
 	}
 
-	result := instance
+	result := instance.Where(condition).Find(&row)
 
-	_, err := result.DB()
+	err = result.Error
 	if err != nil {
 		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
 		return row, err
 	}
+	if result.RowsAffected == 0 {
+		log.Println(fmt.Sprintf("no %v found with id: %v", reflect.TypeOf(*new(T)).Name(), id))
+		return row, notFound[T](id)
+	}
 	return row, nil
 }
 
-func GetOneSoftDeletedById[T any](databaseInstance *gorm.DB, id string, preloads ...string) (T, error) {
+func GetOneSoftDeletedById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, preloads ...string) (T, error) {
 	log.Println(fmt.Sprintf("\n\nretreiving single row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
 	var row T
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, err
+	}
+
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, err
+	}
 
-	var instance *gorm.DB
-	if len(preloads) == 0 {
-		instance = databaseInstance.Unscoped().Where("id=?", id).Find(&row)
-	} else {
-		instance = preloadsHandler(databaseInstance, preloads...).Unscoped().Where("id=?", id).Find(&row)
+	instance, err := projected[T](ctx, databaseInstance, "", preloads...)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, err
 	}
 
-	result := instance
+	result := instance.Unscoped().Where(condition).Find(&row)
 
-	_, err := result.DB()
+	err = result.Error
 	if err != nil {
 		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
 		return row, err
 	}
+	if result.RowsAffected == 0 {
+		log.Println(fmt.Sprintf("no %v found with id: %v", reflect.TypeOf(*new(T)).Name(), id))
+		return row, notFound[T](id)
+	}
 	return row, nil
 }
 
-func GetOneByModelPropertiesCheckIdPresence[T any](databaseInstance *gorm.DB, queryMap map[string]interface{}) (T, error) {
+func GetOneByModelPropertiesCheckIdPresence[T any](ctx context.Context, databaseInstance *gorm.DB, queryMap map[string]interface{}) (T, error) {
 	log.Println(fmt.Sprintf("\n\nretreiving single row of: %v by values: %#v", reflect.TypeOf(*new(T)).Name(), queryMap))
 	var row T
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, err
+	}
 	result := databaseInstance.Where(queryMap).First(&row)
-	_, err := result.DB()
+	err = result.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = withKind(ErrNotFound, err)
+	}
 	if err != nil {
 		log.Println(fmt.Sprintf("failed to retrieve: %v %v", reflect.TypeOf(*new(T)).Name(), err))
 		return row, err
 	}
 
-	r := reflect.ValueOf(row)
-	f := reflect.Indirect(r).FieldByName("Id")
-	if f.String() == "" {
-		msg := "record not found"
-		log.Println(msg)
-		return row, errors.New(msg)
+	if !hasPrimaryKey(ctx, row) {
+		log.Println("record not found")
+		return row, withKind(ErrNotFound, gorm.ErrRecordNotFound)
 	}
 	return row, nil
 }
 
-func PatchById[T any](databaseInstance *gorm.DB, id, columnName string, value interface{}) (T, error) {
+// PatchById sets one column of the row of T with the given id, running the
+// update hooks of T around the write.
+func PatchById[T any](ctx context.Context, databaseInstance *gorm.DB, id, columnName string, value interface{}) (T, error) {
+	return withHooks[T](ctx, databaseInstance, AuditPatch, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		old, err := getOneById[T](ctx, tx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		preview := old
+		index, ok := structField(modelType[T](), columnName)
+		if !ok {
+			return nil, nil, withKind(ErrValidation, fmt.Errorf("%v has no field: %v", modelType[T]().Name(), columnName))
+		}
+		if err := setValue(reflect.ValueOf(&preview).Elem().FieldByIndex(index), value); err != nil {
+			return nil, nil, withKind(ErrValidation, fmt.Errorf("invalid value for %v: %w", columnName, err))
+		}
+		return &old, &preview, nil
+	}, func(ctx context.Context, tx *gorm.DB) (T, *T, error) {
+		patched, err := patchColumnById[T](ctx, tx, id, columnName, value)
+		return patched, &patched, err
+	})
+}
+
+func patchColumnById[T any](ctx context.Context, databaseInstance *gorm.DB, id, columnName string, value interface{}) (T, error) {
 	log.Println(fmt.Sprintf("\n\npatch column: %v row of: %v by id: %v", columnName, reflect.TypeOf(*new(T)).Name(), id))
-	one, err := GetOneById[T](databaseInstance, id)
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return *new(T), err
+	}
+	one, err := getOneById[T](ctx, databaseInstance, id)
 	var t2 T
 	if err != nil {
 		return t2, err
 	}
 
+	versionCondition, current, err := checkVersion[T](ctx, one, nil)
 	if err != nil {
-		log.Println(fmt.Sprintf("failed to map structure: %v", err))
+		log.Println(fmt.Sprintf("failed to patch: %v", err))
 		return t2, err
 	}
-	//result := database.Instance.Where("id=?", id).Update(stringy.New(columnName).SnakeCase("?", "").ToLower(), value).Scan(&one)
-	result := databaseInstance.Model(&one).Where("id=?", id).Update(stringy.New(columnName).SnakeCase("?", "").ToLower(), value).Scan(&one)
+
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		return t2, err
+	}
+
+	if isTenantColumn[T](ctx, columnName) {
+		return t2, withKind(ErrValidation, fmt.Errorf("the tenant of %v cannot be patched", reflect.TypeOf(*new(T)).Name()))
+	}
+
+	updates := map[string]interface{}{stringy.New(columnName).SnakeCase("?", "").ToLower(): value}
+	instance := databaseInstance.Model(&one).Where(condition)
+	if versionCondition != nil {
+		updates[versionColumn[T]()] = current + 1
+		instance = instance.Where(versionCondition)
+	}
+
+	result := instance.Updates(updates)
 	rowsAffected := result.RowsAffected
 	log.Println(fmt.Sprintf("rows affected: %v", utils.ConvertInt64ToStr(rowsAffected)))
 
 	if result.Error != nil {
 		log.Println(fmt.Sprintf("failed to patch env: %v", result.Error))
-		return t2, result.Error
+		return t2, translateError[T](ctx, databaseInstance, result.Error)
 	}
 
 	if result.RowsAffected == 0 {
 		log.Println(fmt.Sprintf("not updated: affected rows: %v", result.RowsAffected))
-		return t2, errors.New("not patched")
+		if versionCondition != nil {
+			return t2, concurrentConflict[T](ctx, databaseInstance, id, current)
+		}
+		return t2, notFound[T](id)
 	}
 
-	return one, nil
+	return getOneById[T](ctx, databaseInstance, id)
+}
+
+// UpdateById writes the non-zero fields of t to the row of T with the given id,
+// running the update hooks of T around the write.
+func UpdateById[T any](ctx context.Context, databaseInstance *gorm.DB, t T, id string) (T, error) {
+	return withHooks[T](ctx, databaseInstance, AuditUpdate, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		old, err := getOneById[T](ctx, tx, id)
+		return &old, &t, err
+	}, func(ctx context.Context, tx *gorm.DB) (T, *T, error) {
+		updated, err := updateById[T](ctx, tx, t, id)
+		return updated, &updated, err
+	})
 }
 
-func UpdateById[T any](databaseInstance *gorm.DB, t T, id string) (T, error) {
+func updateById[T any](ctx context.Context, databaseInstance *gorm.DB, t T, id string) (T, error) {
 
 	log.Println(fmt.Sprintf("\n\nupdating row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
-	one, err := GetOneById[T](databaseInstance, id)
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return *new(T), err
+	}
+	one, err := getOneById[T](ctx, databaseInstance, id)
 	var t2 T
 	if err != nil {
 		return t2, err
 	}
 
+	versionCondition, current, err := checkVersion[T](ctx, one, &t)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to update: %v", err))
+		return t2, err
+	}
+
 	err = mapstructure.Decode(t, &one)
 
 	if err != nil {
@@ -260,29 +450,63 @@ func UpdateById[T any](databaseInstance *gorm.DB, t T, id string) (T, error) {
 		return t2, err
 	}
 
+	// an update never moves the row to another tenant
+	if err := stampTenant[T](ctx, &one); err != nil {
+		return t2, err
+	}
+
 	// set the createdAt date and updatedAt
 
-	result := databaseInstance.Where("id=?", id).Updates(&one).Scan(&one)
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		return t2, err
+	}
+	instance := databaseInstance.Where(condition)
+	if versionCondition != nil {
+		setVersion(&one, current+1)
+		instance = instance.Where(versionCondition)
+	}
+
+	result := instance.Updates(&one)
 	rowsAffected := result.RowsAffected
 	log.Println(fmt.Sprintf("rows affected: %v", utils.ConvertInt64ToStr(rowsAffected)))
 
 	if result.Error != nil {
 		log.Println(fmt.Sprintf("failed to update env: %v", result.Error))
-		return t2, result.Error
+		return t2, translateError[T](ctx, databaseInstance, result.Error)
 	}
 
 	if result.RowsAffected == 0 {
 		log.Println(fmt.Sprintf("not updated: affected rows: %v", result.RowsAffected))
-		return t2, errors.New("not updated")
+		if versionCondition != nil {
+			return t2, concurrentConflict[T](ctx, databaseInstance, id, current)
+		}
+		return t2, notFound[T](id)
 	}
 
-	return one, nil
+	return getOneById[T](ctx, databaseInstance, id)
 }
 
-func DeleteHardById[T any](databaseInstance *gorm.DB, id string) (int64, error) {
+// DeleteHardById deletes the row of T with the given id, running the delete
+// hooks of T around the delete.
+func DeleteHardById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (int64, error) {
+	return withHooks[T](ctx, databaseInstance, AuditDeleteHard, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		old, err := getOneById[T](ctx, tx, id)
+		return &old, nil, err
+	}, func(ctx context.Context, tx *gorm.DB) (int64, *T, error) {
+		rowsAffected, err := deleteHardById[T](ctx, tx, id)
+		return rowsAffected, nil, err
+	})
+}
+
+func deleteHardById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (int64, error) {
 	log.Println(fmt.Sprintf("\n\nhard deleting a row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return 0, err
+	}
 
-	one, err := GetOneById[T](databaseInstance, id)
+	one, err := getOneById[T](ctx, databaseInstance, id)
 	var t2 T
 	if err != nil {
 		return 0, err
@@ -295,35 +519,49 @@ func DeleteHardById[T any](databaseInstance *gorm.DB, id string) (int64, error)
 		return 0, err
 	}
 
-	r := databaseInstance.Delete(&one).Where("id=?", id)
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	r := databaseInstance.Where(condition).Delete(&one)
 
 	if r.Error != nil {
 		log.Println(fmt.Sprintf("failed to delete row by id: %v", id))
 		log.Println(fmt.Sprintf("err: %v", r.Error))
-		return 0, r.Error
+		return 0, translateError[T](ctx, databaseInstance, r.Error)
 	}
 
 	if r.RowsAffected <= 0 {
 		log.Println(fmt.Sprintf("failed to delete row by id: %v", id))
 		log.Println(fmt.Sprintf("number of rows deleted: %v", r.RowsAffected))
-		return 0, r.Error
+		return 0, notFound[T](id)
 	}
 
 	return r.RowsAffected, nil
 }
 
-func DeleteSoftById[T any](databaseInstance *gorm.DB, id string) (int64, error) {
+// DeleteSoftById soft deletes the row of T with the given id, running the
+// delete hooks of T around the delete.
+func DeleteSoftById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (int64, error) {
+	return withHooks[T](ctx, databaseInstance, AuditDeleteSoft, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		old, err := getOneById[T](ctx, tx, id)
+		return &old, nil, err
+	}, func(ctx context.Context, tx *gorm.DB) (int64, *T, error) {
+		rowsAffected, err := deleteSoftById[T](ctx, tx, id)
+		return rowsAffected, nil, err
+	})
+}
+
+func deleteSoftById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (int64, error) {
 	log.Println(fmt.Sprintf("\n\nsoft deleting a row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
-	one, err := GetOneById[T](databaseInstance, id)
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
 	if err != nil {
-		log.Println(fmt.Sprintf("failed to get record by id:% %v", id, err))
 		return 0, err
 	}
-
-	if utils.IsNullOrEmpty(utils.SafeGetFromInterface(one, "$.id")) {
-		msg := fmt.Sprintf("no record found with id: %v", id)
-		log.Println(msg)
-		return 0, errors.New(msg)
+	one, err := getOneById[T](ctx, databaseInstance, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to get record by id: %v %v", id, err))
+		return 0, err
 	}
 
 	var t2 T
@@ -335,35 +573,49 @@ func DeleteSoftById[T any](databaseInstance *gorm.DB, id string) (int64, error)
 		return 0, err
 	}
 
-	r := databaseInstance.Delete(&one).Where("id=?", id)
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	r := databaseInstance.Where(condition).Delete(&one)
 
 	if r.Error != nil {
 		log.Println(fmt.Sprintf("failed to delete row by id: %v", id))
 		log.Println(fmt.Sprintf("err: %v", r.Error))
-		return 0, r.Error
+		return 0, translateError[T](ctx, databaseInstance, r.Error)
 	}
 
 	if r.RowsAffected <= 0 {
 		log.Println(fmt.Sprintf("failed to delete row by id: %v", id))
 		log.Println(fmt.Sprintf("number of rows deleted: %v", r.RowsAffected))
-		return 0, r.Error
+		return 0, notFound[T](id)
 	}
 
 	return r.RowsAffected, nil
 }
 
-func DeletePermanentById[T any](databaseInstance *gorm.DB, id string) (int64, error) {
+// DeletePermanentById removes the row of T with the given id, even a soft
+// deleted one, running the delete hooks of T around the delete.
+func DeletePermanentById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (int64, error) {
+	return withHooks[T](ctx, databaseInstance, AuditDeletePermanent, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		old, err := GetOneSoftDeletedById[T](ctx, tx, id)
+		return &old, nil, err
+	}, func(ctx context.Context, tx *gorm.DB) (int64, *T, error) {
+		rowsAffected, err := deletePermanentById[T](ctx, tx, id)
+		return rowsAffected, nil, err
+	})
+}
+
+func deletePermanentById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (int64, error) {
 	log.Println(fmt.Sprintf("\n\nsoft deleting a row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
-	one, err := GetOneSoftDeletedById[T](databaseInstance, id)
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
 	if err != nil {
-		log.Println(fmt.Sprintf("failed to get record by id:% %v", id, err))
 		return 0, err
 	}
-
-	if utils.IsNullOrEmpty(utils.SafeGetFromInterface(one, "$.id")) {
-		msg := fmt.Sprintf("no record found with id: %v", id)
-		log.Println(msg)
-		return 0, errors.New(msg)
+	one, err := GetOneSoftDeletedById[T](ctx, databaseInstance, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to get record by id: %v %v", id, err))
+		return 0, err
 	}
 
 	var t2 T
@@ -375,18 +627,22 @@ func DeletePermanentById[T any](databaseInstance *gorm.DB, id string) (int64, er
 		return 0, err
 	}
 
-	r := databaseInstance.Unscoped().Delete(&one).Where("id=?", id)
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	r := databaseInstance.Unscoped().Where(condition).Delete(&one)
 
 	if r.Error != nil {
 		log.Println(fmt.Sprintf("failed to delete row by id: %v", id))
 		log.Println(fmt.Sprintf("err: %v", r.Error))
-		return 0, r.Error
+		return 0, translateError[T](ctx, databaseInstance, r.Error)
 	}
 
 	if r.RowsAffected <= 0 {
 		log.Println(fmt.Sprintf("failed to delete row by id: %v", id))
 		log.Println(fmt.Sprintf("number of rows deleted: %v", r.RowsAffected))
-		return 0, r.Error
+		return 0, notFound[T](id)
 	}
 
 	return r.RowsAffected, nil
@@ -0,0 +1,156 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Hook is a function run around a write of a row of T. old is the row as it was
+// stored before the write and new the row being written; old is nil for
+// creates and new is nil for deletes.
+//
+// Hooks run in the transaction of the write: a hook that returns an error
+// aborts the write and rolls back everything done in the transaction,
+// including the work of the hooks run before it. Database work a hook does
+// through the functions of this package with ctx joins that transaction.
+type Hook[T any] func(ctx context.Context, old, new *T) error
+
+type hookEvent int
+
+const (
+	hookCreate hookEvent = iota
+	hookUpdate
+	hookDelete
+	hookRestore
+)
+
+type hookKey struct {
+	event hookEvent
+	after bool
+}
+
+func addHook[T any](key hookKey, hook Hook[T]) {
+	updateModelSettings[T](func(s *modelSettings) {
+		// copied so that the settings already handed out are never mutated
+		hooks := make(map[hookKey][]interface{}, len(s.hooks)+1)
+		for k, v := range s.hooks {
+			hooks[k] = v
+		}
+		hooks[key] = append(append([]interface{}{}, hooks[key]...), hook)
+		s.hooks = hooks
+	})
+}
+
+// OnBeforeCreate registers a hook run by Create and CreateBatch before each row
+// is inserted. Changes the hook makes to new are inserted.
+func OnBeforeCreate[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookCreate}, hook)
+}
+
+// OnAfterCreate registers a hook run by Create and CreateBatch with each row
+// inserted.
+func OnAfterCreate[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookCreate, after: true}, hook)
+}
+
+// OnBeforeUpdate registers a hook run by UpdateById, PatchById, MergePatchById
+// and JSONPatchById before a row is written. new is the update given to
+// UpdateById, whose changes by the hook are written, and the patched row for
+// the patches.
+func OnBeforeUpdate[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookUpdate}, hook)
+}
+
+// OnAfterUpdate registers a hook run by UpdateById, PatchById, MergePatchById
+// and JSONPatchById with the row as it was and as it was stored.
+func OnAfterUpdate[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookUpdate, after: true}, hook)
+}
+
+// OnBeforeDelete registers a hook run by DeleteSoftById, DeleteHardById and
+// DeletePermanentById before a row is deleted.
+func OnBeforeDelete[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookDelete}, hook)
+}
+
+// OnAfterDelete registers a hook run by DeleteSoftById, DeleteHardById and
+// DeletePermanentById with the row deleted.
+func OnAfterDelete[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookDelete, after: true}, hook)
+}
+
+// OnBeforeRestore registers a hook run by RestoreById before a soft deleted row
+// is restored.
+func OnBeforeRestore[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookRestore}, hook)
+}
+
+// OnAfterRestore registers a hook run by RestoreById with the soft deleted row
+// and the restored row.
+func OnAfterRestore[T any](hook Hook[T]) {
+	addHook[T](hookKey{event: hookRestore, after: true}, hook)
+}
+
+func hasHooks[T any](event hookEvent) bool {
+	hooks := getModelSettings[T]().hooks
+	return len(hooks[hookKey{event: event}]) > 0 || len(hooks[hookKey{event: event, after: true}]) > 0
+}
+
+// runHooks runs the hooks of T registered for event in the order they were
+// registered, stopping at the first error.
+func runHooks[T any](ctx context.Context, event hookEvent, after bool, old, new *T) error {
+	for _, hook := range getModelSettings[T]().hooks[hookKey{event: event, after: after}] {
+		if err := hook.(Hook[T])(ctx, old, new); err != nil {
+			log.Println(fmt.Sprintf("hook of: %v aborted the operation: %v", modelType[T]().Name(), err))
+			return err
+		}
+	}
+	return nil
+}
+
+// withHooks runs write between the hooks of T registered for the event of
+// operation and returns its result. When T has such hooks or is audited, load
+// returns the old and new rows handed to the before hooks, write returns the
+// row handed to the after hooks as new, and everything, the audit entry
+// included, runs in one transaction; the result of a write rolled back by a
+// hook is not returned.
+func withHooks[T, R any](ctx context.Context, databaseInstance *gorm.DB, operation AuditOperation, load func(ctx context.Context, tx *gorm.DB) (*T, *T, error), write func(ctx context.Context, tx *gorm.DB) (R, *T, error)) (R, error) {
+	ctx = transactionContext(ctx, databaseInstance)
+	defer invalidate[T](ctx)
+
+	event := operation.event()
+	if !hasHooks[T](event) && !audited[T]() {
+		result, _, err := write(ctx, databaseInstance)
+		return result, err
+	}
+
+	var result R
+	err := WithTransaction(ctx, databaseInstance, func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		old, new, err := load(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if err := runHooks[T](ctx, event, false, old, new); err != nil {
+			return err
+		}
+
+		written, row, err := write(ctx, tx)
+		if err != nil {
+			result = written
+			return err
+		}
+		if err := runHooks[T](ctx, event, true, old, row); err != nil {
+			return err
+		}
+		if err := audit[T](ctx, tx, operation, old, row); err != nil {
+			return err
+		}
+		result = written
+		return nil
+	})
+	return result, err
+}
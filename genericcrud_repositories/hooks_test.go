@@ -0,0 +1,111 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type hookModel struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestRunHooks(t *testing.T) {
+	var calls []string
+	OnBeforeUpdate[hookModel](func(ctx context.Context, old, new *hookModel) error {
+		calls = append(calls, "first:"+old.Name+">"+new.Name)
+		new.Name = "changed"
+		return nil
+	})
+	OnBeforeUpdate[hookModel](func(ctx context.Context, old, new *hookModel) error {
+		calls = append(calls, "second:"+new.Name)
+		return errors.New("refused")
+	})
+	OnBeforeUpdate[hookModel](func(ctx context.Context, old, new *hookModel) error {
+		calls = append(calls, "third")
+		return nil
+	})
+
+	if !hasHooks[hookModel](hookUpdate) || hasHooks[hookModel](hookCreate) {
+		t.Fatal("unexpected hooks registered")
+	}
+
+	old, new := hookModel{Name: "a"}, hookModel{Name: "b"}
+	err := runHooks[hookModel](ctx, hookUpdate, false, &old, &new)
+	if err == nil || err.Error() != "refused" {
+		t.Errorf("expected the hook error, got %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "first:a>b" || calls[1] != "second:changed" {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+	if err := runHooks[hookModel](ctx, hookUpdate, true, &old, &new); err != nil {
+		t.Errorf("expected no after hooks to run, got %v", err)
+	}
+}
+
+type bookedSeat struct {
+	Id     uint   `gorm:"primaryKey" json:"id"`
+	Seat   string `json:"seat"`
+	Holder string `json:"holder"`
+}
+
+type bookingClerkKey struct{}
+
+func TestHooksRollBackWithinSavepoints(t *testing.T) {
+	t.Cleanup(func() { updateModelSettings[bookedSeat](func(s *modelSettings) { s.hooks = nil }) })
+	var clerks []string
+	OnBeforeUpdate[bookedSeat](func(ctx context.Context, old, new *bookedSeat) error {
+		clerks = append(clerks, ctx.Value(bookingClerkKey{}).(string))
+		if old.Holder != "" && new.Holder != old.Holder {
+			return errors.New("seat taken by " + old.Holder)
+		}
+		return nil
+	})
+	OnAfterDelete[bookedSeat](func(ctx context.Context, old, new *bookedSeat) error {
+		if old.Seat == "vip" {
+			return errors.New("the vip seat cannot be removed")
+		}
+		return nil
+	})
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&bookedSeat{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(ctx, bookingClerkKey{}, "zoe")
+
+	err := WithTransaction(ctx, db, func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		if _, err := Create[bookedSeat](ctx, &bookedSeat{Seat: "1a"}, tx); err != nil {
+			return err
+		}
+		if _, err := UpdateById[bookedSeat](ctx, tx, bookedSeat{Holder: "ann"}, "1"); err != nil {
+			return err
+		}
+		// the refused update only rolls back its own savepoint
+		if _, err := UpdateById[bookedSeat](ctx, tx, bookedSeat{Holder: "bob"}, "1"); err == nil || err.Error() != "seat taken by ann" {
+			return fmt.Errorf("expected the hook error, got %v", err)
+		}
+		_, err := Create[bookedSeat](ctx, &bookedSeat{Seat: "vip"}, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seats []bookedSeat
+	db.Order("id").Find(&seats)
+	if fmt.Sprint(seats) != "[{1 1a ann} {2 vip }]" || fmt.Sprint(clerks) != "[zoe zoe]" {
+		t.Errorf("expected the outer transaction to commit around the refused update, got %v %v", seats, clerks)
+	}
+
+	// an after hook undoes the write it follows
+	if _, err := DeleteHardById[bookedSeat](ctx, db, "2"); err == nil {
+		t.Error("expected the hook error")
+	}
+	if _, err := GetOneById[bookedSeat](ctx, db, "2"); err != nil {
+		t.Errorf("expected the delete to be rolled back, got %v", err)
+	}
+}
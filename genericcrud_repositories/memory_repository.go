@@ -0,0 +1,791 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+)
+
+// MemoryRepository is a map backed Repository that is safe for concurrent use.
+// It follows the semantics of GormRepository, so services and controllers can
+// be exercised without a database: rows of models with a gorm.DeletedAt field
+// are soft deleted, lists are paged, sorted, filtered on equality and searched
+// the way SearchLike does, and missing rows fail with an error matching
+// ErrNotFound. Operations fail with the error of their context once it is done. Hooks
+// registered with OnBeforeCreate and the other On* functions are not run.
+type MemoryRepository[T any] struct {
+	mu         sync.RWMutex
+	rows       map[string]T
+	deleted    map[string]bool
+	order      []string
+	nextId     int64
+	softDelete bool
+	options    repositoryOptions
+}
+
+var _ Repository[struct{}] = (*MemoryRepository[struct{}])(nil)
+
+// NewMemoryRepository accepts the same options as NewGormRepository; preloads
+// and caches are ignored. Like those of a GormRepository, the options hold for
+// this repository only.
+func NewMemoryRepository[T any](options ...RepositoryOption) *MemoryRepository[T] {
+	o := repositoryOptions{softDelete: true}
+	for _, option := range options {
+		option(&o)
+	}
+
+	return &MemoryRepository[T]{
+		rows:       map[string]T{},
+		deleted:    map[string]bool{},
+		softDelete: o.softDelete,
+		options:    o,
+	}
+}
+
+// context carries the options of r through ctx, where they take precedence
+// over the settings registered for T.
+func (r *MemoryRepository[T]) context(ctx context.Context) context.Context {
+	return withRepositoryOptions[T](ctx, r.options)
+}
+
+func (r *MemoryRepository[T]) field(row *T, column string) (reflect.Value, bool) {
+	index, ok := structField(modelType[T](), column)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(row).Elem().FieldByIndex(index), true
+}
+
+func (r *MemoryRepository[T]) key(row T) string {
+	ctx := r.context(context.Background())
+	if !hasPrimaryKey(ctx, row) {
+		return ""
+	}
+	return idOf(ctx, row)
+}
+
+// canonicalId checks that id fits the primary key of T and rewrites it the way
+// IdOf prints keys.
+func (r *MemoryRepository[T]) canonicalId(id string) (string, error) {
+	return canonicalId[T](r.context(context.Background()), id)
+}
+
+func (r *MemoryRepository[T]) hasSoftDelete() bool {
+	index, ok := structField(modelType[T](), "deleted_at")
+	return ok && modelType[T]().FieldByIndex(index).Type == reflect.TypeOf(gorm.DeletedAt{})
+}
+
+func (r *MemoryRepository[T]) touch(row *T, columns ...string) {
+	now := time.Now()
+	for _, column := range columns {
+		if value, ok := r.field(row, column); ok && value.Type() == reflect.TypeOf(now) && value.CanSet() {
+			value.Set(reflect.ValueOf(now))
+		}
+	}
+}
+
+// setValue assigns value to field, converting strings and json numbers to
+// the type of the field.
+func setValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	converted, err := convertValue(field.Type(), value)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(converted)
+	if field.Kind() == reflect.Ptr && v.Type() != field.Type() {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), converted); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if !v.Type().ConvertibleTo(field.Type()) {
+		return fmt.Errorf("cannot assign %T to %v", converted, field.Type())
+	}
+	field.Set(v.Convert(field.Type()))
+	return nil
+}
+
+func (r *MemoryRepository[T]) insert(model T) (T, error) {
+	key, err := r.prepare(&model, nil)
+	if err != nil {
+		return model, err
+	}
+	r.store(key, model)
+	return model, nil
+}
+
+// prepare gives model an id when it has none and returns its key, failing when
+// a row, or one of the keys taken by the rest of its batch, has it already.
+func (r *MemoryRepository[T]) prepare(model *T, taken map[string]bool) (string, error) {
+	ctx := r.context(context.Background())
+	key := r.key(*model)
+	if key == "" {
+		r.nextId++
+		columns := primaryKeyColumns[T](ctx)
+		if len(columns) != 1 {
+			return "", fmt.Errorf("the composite primary key of %v must be set", modelType[T]().Name())
+		}
+		field, ok := r.field(model, columns[0])
+		if !ok {
+			return "", fmt.Errorf("%v has no primary key field: %v", modelType[T]().Name(), columns[0])
+		}
+		if err := setValue(field, fmt.Sprint(r.nextId)); err != nil {
+			return "", err
+		}
+		key = r.key(*model)
+	}
+
+	if _, exists := r.rows[key]; exists || taken[key] {
+		var fields []string
+		for _, column := range primaryKeyColumns[T](ctx) {
+			fields = append(fields, utils.ToCamelCaseLower(column))
+		}
+		return "", &ConstraintError{Type: ConstraintUnique, Fields: fields, Err: fmt.Errorf("duplicate primary key: %v", key)}
+	}
+	return key, nil
+}
+
+func (r *MemoryRepository[T]) store(key string, model T) {
+	r.touch(&model, "created_at", "updated_at")
+	r.rows[key] = model
+	r.order = append(r.order, key)
+}
+
+func (r *MemoryRepository[T]) Create(ctx context.Context, model T) (T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return *new(T), err
+	}
+	if err := stampTenant[T](ctx, &model); err != nil {
+		return *new(T), err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.insert(model)
+}
+
+// CreateBatch inserts all of models or, like the insert of GormRepository,
+// none of them when one fails.
+func (r *MemoryRepository[T]) CreateBatch(ctx context.Context, models []T) ([]T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nextId := r.nextId
+	created := make([]T, len(models))
+	keys := make([]string, len(models))
+	taken := map[string]bool{}
+	for i, model := range models {
+		if err := stampTenant[T](ctx, &model); err != nil {
+			r.nextId = nextId
+			return nil, err
+		}
+		key, err := r.prepare(&model, taken)
+		if err != nil {
+			r.nextId = nextId
+			return nil, err
+		}
+		created[i], keys[i], taken[key] = model, key, true
+	}
+
+	for i := range created {
+		r.store(keys[i], created[i])
+		created[i] = r.rows[keys[i]]
+	}
+	return created, nil
+}
+
+func (r *MemoryRepository[T]) GetAll(ctx context.Context, pagination Pagination) (Page[T], error) {
+	ctx = r.context(ctx)
+	return r.GetAllByFields(ctx, pagination, nil)
+}
+
+func (r *MemoryRepository[T]) GetAllByFields(ctx context.Context, pagination Pagination, queryMap map[string]interface{}) (Page[T], error) {
+	ctx = r.context(ctx)
+	return r.list(ctx, pagination, queryMap, false)
+}
+
+// list pages through the live rows, or the soft deleted ones when trash is set.
+func (r *MemoryRepository[T]) list(ctx context.Context, pagination Pagination, queryMap map[string]interface{}, trash bool) (Page[T], error) {
+	if err := ctx.Err(); err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+	if pagination.Cursor != "" {
+		return newPage([]T{}, 0, pagination), errors.New("cursor pagination is not supported by the in-memory repository")
+	}
+	if err := ValidateFilters[T](pagination.Filters); err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+	if err := validateSearch[T](pagination); err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+	fields, err := ParseSort[T](pagination.Sort)
+	if err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+
+	conditions, err := r.conditions(queryMap, pagination.Filters)
+	if err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+
+	scope, err := r.scope(ctx)
+	if err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+
+	r.mu.RLock()
+	all, err := r.selectRows(conditions, scope, trash)
+	r.mu.RUnlock()
+	if err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+
+	// like LIKE searches, rows are ranked by the number of words they match
+	ranks := map[string]int{}
+	if len(searchTerms(pagination.Search)) > 0 {
+		found := all[:0]
+		for i := range all {
+			if rank := searchRank(&all[i], pagination.Search); rank > 0 {
+				ranks[r.key(all[i])] = rank
+				found = append(found, all[i])
+			}
+		}
+		all = found
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if a, b := ranks[r.key(all[i])], ranks[r.key(all[j])]; a != b {
+			return a > b
+		}
+		for _, f := range fields {
+			a, _ := r.field(&all[i], f.Column)
+			b, _ := r.field(&all[j], f.Column)
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != f.Desc
+			}
+		}
+		return false
+	})
+
+	offset, limit := pagination.params()
+	total := int64(len(all))
+	rows := []T{}
+	if offset < len(all) {
+		end := offset + limit
+		if end > len(all) {
+			end = len(all)
+		}
+		rows = all[offset:end]
+	}
+	return newPage(rows, total, pagination), nil
+}
+
+// conditions merges queryMap and the filters, which must all be equalities.
+func (r *MemoryRepository[T]) conditions(queryMap map[string]interface{}, filters Filters) (map[string]interface{}, error) {
+	conditions := map[string]interface{}{}
+	for column, value := range queryMap {
+		conditions[column] = value
+	}
+	for _, f := range filters {
+		if f.Operator != FilterEq {
+			return nil, fmt.Errorf("%v filters are not supported by the in-memory repository", f.Operator)
+		}
+		conditions[f.Field] = f.Value
+	}
+	return conditions, nil
+}
+
+// scope is the condition restricting rows to the tenant of ctx, if T is scoped
+// by tenant.
+func (r *MemoryRepository[T]) scope(ctx context.Context) (map[string]interface{}, error) {
+	tenant, ok, err := tenantValue[T](ctx)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return map[string]interface{}{tenantColumn[T](ctx): tenant}, nil
+}
+
+// owned fails with ErrNoTenant without a tenant in ctx, and reports the row
+// with the given id as not found when it belongs to another tenant.
+func (r *MemoryRepository[T]) owned(ctx context.Context, id string) error {
+	scope, err := r.scope(ctx)
+	if err != nil {
+		return err
+	}
+	row, exists := r.rows[id]
+	if !exists {
+		return nil
+	}
+	if matches, err := r.matches(&row, scope); err != nil || !matches {
+		return notFound[T](id)
+	}
+	return nil
+}
+
+// selectRows returns the live rows, or the soft deleted ones when trash is
+// set, matching both conditions and scope in insertion order.
+func (r *MemoryRepository[T]) selectRows(conditions, scope map[string]interface{}, trash bool) ([]T, error) {
+	var all []T
+	for _, key := range r.order {
+		if r.deleted[key] != trash {
+			continue
+		}
+		row := r.rows[key]
+		matches, err := r.matches(&row, conditions)
+		if err != nil {
+			return nil, err
+		}
+		inScope, err := r.matches(&row, scope)
+		if err != nil {
+			return nil, err
+		}
+		if matches && inScope {
+			all = append(all, row)
+		}
+	}
+	return all, nil
+}
+
+func (r *MemoryRepository[T]) matches(row *T, conditions map[string]interface{}) (bool, error) {
+	for column, value := range conditions {
+		field, ok := r.field(row, column)
+		if !ok {
+			return false, fmt.Errorf("%v has no column: %v", modelType[T]().Name(), column)
+		}
+
+		expected := reflect.New(field.Type()).Elem()
+		if err := setValue(expected, value); err != nil {
+			return false, err
+		}
+		if !reflect.DeepEqual(field.Interface(), expected.Interface()) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareValues orders numbers, strings, booleans and times; other values are
+// compared by their printed form.
+func compareValues(a, b reflect.Value) int {
+	for a.Kind() == reflect.Ptr && b.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			return compareBools(!a.IsNil(), !b.IsNil())
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+
+	if ta, ok := a.Interface().(time.Time); ok {
+		tb := b.Interface().(time.Time)
+		return compareBools(ta.After(tb), tb.After(ta))
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareBools(a.Int() > b.Int(), a.Int() < b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareBools(a.Uint() > b.Uint(), a.Uint() < b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareBools(a.Float() > b.Float(), a.Float() < b.Float())
+	case reflect.Bool:
+		return compareBools(a.Bool(), b.Bool())
+	}
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func compareBools(greater, less bool) int {
+	switch {
+	case greater && !less:
+		return 1
+	case less && !greater:
+		return -1
+	}
+	return 0
+}
+
+func (r *MemoryRepository[T]) GetOneById(ctx context.Context, id string) (T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return *new(T), err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return *new(T), err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.owned(ctx, id); err != nil {
+		return *new(T), err
+	}
+
+	row, ok := r.live(id)
+	if !ok {
+		return *new(T), notFound[T](id)
+	}
+	return row, nil
+}
+
+func (r *MemoryRepository[T]) GetOneSoftDeletedById(ctx context.Context, id string) (T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return *new(T), err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return *new(T), err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.owned(ctx, id); err != nil {
+		return *new(T), err
+	}
+
+	row, ok := r.rows[id]
+	if !ok {
+		return *new(T), notFound[T](id)
+	}
+	return row, nil
+}
+
+func (r *MemoryRepository[T]) live(id string) (T, bool) {
+	row, ok := r.rows[id]
+	return row, ok && !r.deleted[id]
+}
+
+func (r *MemoryRepository[T]) UpdateById(ctx context.Context, t T, id string) (T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return *new(T), err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return *new(T), err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.owned(ctx, id); err != nil {
+		return *new(T), err
+	}
+
+	row, ok := r.live(id)
+	if !ok {
+		return *new(T), notFound[T](id)
+	}
+
+	versionCondition, current, err := checkVersion[T](ctx, row, &t)
+	if err != nil {
+		return *new(T), err
+	}
+
+	// like gorm's Updates, only the non-zero fields are written
+	source, target := reflect.ValueOf(t), reflect.ValueOf(&row).Elem()
+	for i := 0; i < source.NumField(); i++ {
+		name := modelType[T]().Field(i).Name
+		if !modelType[T]().Field(i).IsExported() || isPrimaryKeyColumn[T](ctx, name) || isTenantColumn[T](ctx, name) {
+			continue
+		}
+		if !source.Field(i).IsZero() {
+			target.Field(i).Set(source.Field(i))
+		}
+	}
+
+	if versionCondition != nil {
+		setVersion(&row, current+1)
+	}
+	r.touch(&row, "updated_at")
+	r.rows[id] = row
+	return row, nil
+}
+
+func (r *MemoryRepository[T]) PatchById(ctx context.Context, id, columnName string, value interface{}) (T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return *new(T), err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return *new(T), err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.owned(ctx, id); err != nil {
+		return *new(T), err
+	}
+
+	row, ok := r.live(id)
+	if !ok {
+		return *new(T), notFound[T](id)
+	}
+
+	versionCondition, current, err := checkVersion[T](ctx, row, nil)
+	if err != nil {
+		return *new(T), err
+	}
+
+	if isTenantColumn[T](ctx, columnName) {
+		return *new(T), withKind(ErrValidation, fmt.Errorf("the tenant of %v cannot be patched", modelType[T]().Name()))
+	}
+	field, ok := r.field(&row, columnName)
+	if !ok {
+		return *new(T), fmt.Errorf("%v has no column: %v", modelType[T]().Name(), columnName)
+	}
+	if err := setValue(field, value); err != nil {
+		return *new(T), err
+	}
+
+	if versionCondition != nil {
+		setVersion(&row, current+1)
+	}
+	r.touch(&row, "updated_at")
+	r.rows[id] = row
+	return row, nil
+}
+
+func (r *MemoryRepository[T]) Delete(ctx context.Context, id string) (int64, error) {
+	ctx = r.context(ctx)
+	if r.softDelete {
+		return r.DeleteSoftById(ctx, id)
+	}
+	return r.DeletePermanentById(ctx, id)
+}
+
+func (r *MemoryRepository[T]) DeleteSoftById(ctx context.Context, id string) (int64, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.owned(ctx, id); err != nil {
+		return 0, err
+	}
+	return r.delete(id, r.hasSoftDelete())
+}
+
+// DeleteHardById deletes like gorm's Delete does: softly when the model has a
+// gorm.DeletedAt field.
+func (r *MemoryRepository[T]) DeleteHardById(ctx context.Context, id string) (int64, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.owned(ctx, id); err != nil {
+		return 0, err
+	}
+	return r.delete(id, r.hasSoftDelete())
+}
+
+func (r *MemoryRepository[T]) DeletePermanentById(ctx context.Context, id string) (int64, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.owned(ctx, id); err != nil {
+		return 0, err
+	}
+
+	if _, ok := r.rows[id]; !ok {
+		return 0, notFound[T](id)
+	}
+	r.remove(id)
+	return 1, nil
+}
+
+func (r *MemoryRepository[T]) delete(id string, soft bool) (int64, error) {
+	row, ok := r.live(id)
+	if !ok {
+		return 0, notFound[T](id)
+	}
+
+	if !soft {
+		r.remove(id)
+		return 1, nil
+	}
+
+	if field, ok := r.field(&row, "deleted_at"); ok {
+		field.Set(reflect.ValueOf(gorm.DeletedAt{Time: time.Now(), Valid: true}))
+	}
+	r.rows[id] = row
+	r.deleted[id] = true
+	return 1, nil
+}
+
+func (r *MemoryRepository[T]) remove(id string) {
+	delete(r.rows, id)
+	delete(r.deleted, id)
+	for i, key := range r.order {
+		if key == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *MemoryRepository[T]) RestoreById(ctx context.Context, id string) (T, error) {
+	ctx = r.context(ctx)
+	if err := ctx.Err(); err != nil {
+		return *new(T), err
+	}
+	id, err := r.canonicalId(id)
+	if err != nil {
+		return *new(T), err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.owned(ctx, id); err != nil {
+		return *new(T), err
+	}
+
+	row, ok := r.rows[id]
+	if !ok || !r.deleted[id] {
+		return *new(T), notFound[T](id)
+	}
+
+	if field, ok := r.field(&row, "deleted_at"); ok {
+		field.Set(reflect.ValueOf(gorm.DeletedAt{}))
+	}
+	r.rows[id] = row
+	delete(r.deleted, id)
+	return row, nil
+}
+
+func (r *MemoryRepository[T]) GetAllSoftDeleted(ctx context.Context, pagination Pagination) (Page[T], error) {
+	ctx = r.context(ctx)
+	return r.list(ctx, pagination, nil, true)
+}
+
+// bulkRows returns the live rows selected by filter, applying the same empty
+// filter guard as the gorm functions.
+func (r *MemoryRepository[T]) bulkRows(ctx context.Context, filter BulkFilter, unscoped bool) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if filter.empty() && !filter.AllowAll {
+		return nil, ErrEmptyFilter
+	}
+	if err := ValidateFilters[T](filter.Filters); err != nil {
+		return nil, err
+	}
+	conditions, err := r.conditions(filter.QueryMap, filter.Filters)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := r.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.selectRows(conditions, scope, false)
+	if err != nil || !unscoped {
+		return rows, err
+	}
+	trash, err := r.selectRows(conditions, scope, true)
+	return append(rows, trash...), err
+}
+
+func (r *MemoryRepository[T]) UpdateWhere(ctx context.Context, filter BulkFilter, values map[string]interface{}) (int64, error) {
+	ctx = r.context(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rows, err := r.bulkRows(ctx, filter, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("%w: no values to update", ErrInvalidUpdate)
+	}
+	for column := range values {
+		if isPrimaryKeyColumn[T](ctx, column) || isTenantColumn[T](ctx, column) {
+			return 0, fmt.Errorf("%w: %v cannot be updated", ErrInvalidUpdate, column)
+		}
+	}
+	if filter.DryRun {
+		return int64(len(rows)), nil
+	}
+
+	for _, row := range rows {
+		for column, value := range values {
+			field, ok := r.field(&row, column)
+			if !ok {
+				return 0, fmt.Errorf("%w: %v has no column for: %v", ErrInvalidUpdate, modelType[T]().Name(), column)
+			}
+			if err := setValue(field, value); err != nil {
+				return 0, fmt.Errorf("%w: invalid value for %v: %v", ErrInvalidUpdate, column, err)
+			}
+		}
+		if version, ok := VersionOf(row); ok {
+			setVersion(&row, version+1)
+		}
+		r.touch(&row, "updated_at")
+		r.rows[r.key(row)] = row
+	}
+	return int64(len(rows)), nil
+}
+
+func (r *MemoryRepository[T]) DeleteSoftWhere(ctx context.Context, filter BulkFilter) (int64, error) {
+	ctx = r.context(ctx)
+	if !r.hasSoftDelete() {
+		return 0, fmt.Errorf("%v has no gorm.DeletedAt field and cannot be soft deleted", modelType[T]().Name())
+	}
+	return r.deleteWhere(ctx, filter, true)
+}
+
+func (r *MemoryRepository[T]) DeleteHardWhere(ctx context.Context, filter BulkFilter) (int64, error) {
+	ctx = r.context(ctx)
+	return r.deleteWhere(ctx, filter, false)
+}
+
+func (r *MemoryRepository[T]) deleteWhere(ctx context.Context, filter BulkFilter, soft bool) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rows, err := r.bulkRows(ctx, filter, !soft)
+	if err != nil || filter.DryRun {
+		return int64(len(rows)), err
+	}
+	for _, row := range rows {
+		if !soft {
+			r.remove(r.key(row))
+			continue
+		}
+		if _, err := r.delete(r.key(row), true); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(rows)), nil
+}
@@ -0,0 +1,211 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+var ctx = context.Background()
+
+type memoryModel struct {
+	Id        string         `json:"id"`
+	Name      string         `json:"name"`
+	Age       int            `json:"age"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+type memoryHardModel struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMemoryRepositoryCrud(t *testing.T) {
+	r := NewMemoryRepository[memoryModel]()
+
+	created, err := r.Create(ctx, memoryModel{Name: "ann", Age: 30})
+	if err != nil || created.Id == "" {
+		t.Fatalf("create: %+v %v", created, err)
+	}
+
+	updated, err := r.UpdateById(ctx, memoryModel{Name: "anne"}, created.Id)
+	if err != nil || updated.Name != "anne" || updated.Age != 30 {
+		t.Fatalf("update: %+v %v", updated, err)
+	}
+
+	patched, err := r.PatchById(ctx, created.Id, "age", 31.0)
+	if err != nil || patched.Age != 31 {
+		t.Fatalf("patch: %+v %v", patched, err)
+	}
+
+	if _, err := r.PatchById(ctx, created.Id, "unknown", 1); err == nil {
+		t.Error("expected patching an unknown column to fail")
+	}
+
+	if n, err := r.Delete(ctx, created.Id); n != 1 || err != nil {
+		t.Fatalf("delete: %v %v", n, err)
+	}
+	if one, _ := r.GetOneById(ctx, created.Id); one.Id != "" {
+		t.Errorf("soft deleted row is still visible: %+v", one)
+	}
+	if one, _ := r.GetOneSoftDeletedById(ctx, created.Id); !one.DeletedAt.Valid {
+		t.Errorf("expected soft deleted row, got %+v", one)
+	}
+	if _, err := r.DeleteSoftById(ctx, created.Id); err == nil {
+		t.Error("expected deleting a soft deleted row to fail")
+	}
+	if trash, err := r.GetAllSoftDeleted(ctx, Pagination{}); err != nil || trash.Total != 1 || trash.Rows[0].Id != created.Id {
+		t.Errorf("unexpected trash: %+v %v", trash, err)
+	}
+
+	restored, err := r.RestoreById(ctx, created.Id)
+	if err != nil || restored.DeletedAt.Valid {
+		t.Fatalf("restore: %+v %v", restored, err)
+	}
+	if one, _ := r.GetOneById(ctx, created.Id); one.Id != created.Id {
+		t.Errorf("restored row is not visible: %+v", one)
+	}
+	if _, err := r.RestoreById(ctx, created.Id); err == nil {
+		t.Error("expected restoring a live row to fail")
+	}
+	if _, err := r.Delete(ctx, created.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := r.DeletePermanentById(ctx, created.Id); n != 1 || err != nil {
+		t.Fatalf("permanent delete: %v %v", n, err)
+	}
+	if one, _ := r.GetOneSoftDeletedById(ctx, created.Id); one.Id != "" {
+		t.Errorf("permanently deleted row is still stored: %+v", one)
+	}
+}
+
+func TestMemoryRepositoryHardDelete(t *testing.T) {
+	r := NewMemoryRepository[memoryHardModel]()
+	created, _ := r.Create(ctx, memoryHardModel{Name: "x"})
+	if created.Id != 1 {
+		t.Fatalf("expected generated integer id, got %+v", created)
+	}
+
+	if _, err := r.DeleteHardById(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if one, _ := r.GetOneSoftDeletedById(ctx, "1"); one.Id != 0 {
+		t.Errorf("expected row without DeletedAt to be removed, got %+v", one)
+	}
+}
+
+func TestMemoryRepositoryCreateBatch(t *testing.T) {
+	r := NewMemoryRepository[memoryHardModel]()
+	_, _ = r.Create(ctx, memoryHardModel{Id: 3, Name: "c"})
+
+	_, err := r.CreateBatch(ctx, []memoryHardModel{{Name: "a"}, {Name: "b"}, {Id: 3}})
+	var constraint *ConstraintError
+	if !errors.As(err, &constraint) {
+		t.Fatalf("expected a duplicate key to fail the batch, got %v", err)
+	}
+	if page, _ := r.GetAll(ctx, Pagination{}); page.Total != 1 {
+		t.Errorf("expected none of the batch to be inserted, got %+v", page.Rows)
+	}
+
+	created, err := r.CreateBatch(ctx, []memoryHardModel{{Name: "a"}, {Name: "b"}})
+	if err != nil || len(created) != 2 || created[0].Id != 1 || created[1].Id != 2 {
+		t.Errorf("unexpected batch: %+v %v", created, err)
+	}
+}
+
+func TestMemoryRepositoryList(t *testing.T) {
+	SetSortableFields[memoryModel]("name", "age")
+	SetFilterableFields[memoryModel]("age")
+	r := NewMemoryRepository[memoryModel]()
+	for i, name := range []string{"d", "b", "a", "c", "e"} {
+		_, _ = r.Create(ctx, memoryModel{Name: name, Age: 20 + i%2})
+	}
+
+	page, err := r.GetAll(ctx, Pagination{Limit: 2, Page: 2, Sort: "-age,name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 5 || len(page.Rows) != 2 || page.Rows[0].Name != "a" || page.Rows[1].Name != "d" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	filtered, err := r.GetAllByFields(ctx, Pagination{Sort: "name", Filters: Filters{{Field: "age", Operator: FilterEq, Value: "21"}}}, map[string]interface{}{"name": "b"})
+	if err != nil || filtered.Total != 1 || filtered.Rows[0].Name != "b" {
+		t.Errorf("unexpected filtered page: %+v %v", filtered, err)
+	}
+
+	if _, err := r.GetAll(ctx, Pagination{Sort: "id"}); err == nil {
+		t.Error("expected sorting by a field that is not allowed to fail")
+	}
+}
+
+func TestMemoryRepositoryBulkWrites(t *testing.T) {
+	SetFilterableFields[memoryModel]("age")
+	r := NewMemoryRepository[memoryModel]()
+	for i, name := range []string{"a", "b", "c"} {
+		_, _ = r.Create(ctx, memoryModel{Name: name, Age: 20 + i%2})
+	}
+	twenty := BulkFilter{Filters: Filters{{Field: "age", Operator: FilterEq, Value: "20"}}}
+
+	if _, err := r.UpdateWhere(ctx, BulkFilter{}, map[string]interface{}{"age": 1}); !errors.Is(err, ErrEmptyFilter) {
+		t.Errorf("expected an empty filter to be refused, got %v", err)
+	}
+
+	dryRun := twenty
+	dryRun.DryRun = true
+	if n, err := r.DeleteSoftWhere(ctx, dryRun); n != 2 || err != nil {
+		t.Errorf("dry run: %v %v", n, err)
+	}
+
+	if n, err := r.UpdateWhere(ctx, twenty, map[string]interface{}{"name": "x"}); n != 2 || err != nil {
+		t.Fatalf("update: %v %v", n, err)
+	}
+	if n, err := r.DeleteSoftWhere(ctx, BulkFilter{QueryMap: map[string]interface{}{"name": "x"}}); n != 2 || err != nil {
+		t.Fatalf("delete: %v %v", n, err)
+	}
+
+	page, _ := r.GetAll(ctx, Pagination{})
+	if page.Total != 1 || page.Rows[0].Name != "b" {
+		t.Errorf("unexpected rows left: %+v", page)
+	}
+	if n, err := r.UpdateWhere(ctx, BulkFilter{AllowAll: true}, map[string]interface{}{"age": 5}); n != 1 || err != nil {
+		t.Errorf("update all: %v %v", n, err)
+	}
+}
+
+func TestMemoryRepositoryConcurrentCreates(t *testing.T) {
+	r := NewMemoryRepository[memoryModel]()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = r.Create(ctx, memoryModel{Name: fmt.Sprint(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	page, _ := r.GetAll(ctx, Pagination{Limit: 100})
+	if page.Total != 50 {
+		t.Errorf("expected 50 rows, got %v", page.Total)
+	}
+}
+
+func TestMemoryRepositoryHonoursCancellation(t *testing.T) {
+	r := NewMemoryRepository[memoryModel]()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := r.Create(cancelled, memoryModel{Name: "x"}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if page, _ := r.GetAll(ctx, Pagination{}); page.Total != 0 {
+		t.Errorf("expected nothing to be created, got %+v", page)
+	}
+}
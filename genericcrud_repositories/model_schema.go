@@ -0,0 +1,54 @@
+package genericcrud_repositories_gorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/danielcomboni/generic-crud/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// parseSchema returns the gorm schema of T using the naming strategy of the
+// given database instance.
+func parseSchema[T any](databaseInstance *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: databaseInstance}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, fmt.Errorf("failed to parse schema of %v: %w", modelType[T]().Name(), err)
+	}
+	return stmt.Schema, nil
+}
+
+// structField finds the field of t stored in column, looking into embedded
+// structs such as gorm.Model.
+func structField(t reflect.Type, column string) ([]int, bool) {
+	column = utils.ToSnakeCase(column)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if index, ok := structField(f.Type, column); ok {
+				return append([]int{i}, index...), true
+			}
+			continue
+		}
+
+		names := []string{f.Name, strings.Split(f.Tag.Get("json"), ",")[0]}
+		for _, setting := range strings.Split(f.Tag.Get("gorm"), ";") {
+			if strings.HasPrefix(strings.ToLower(setting), "column:") {
+				names = append(names, setting[len("column:"):])
+			}
+		}
+		for _, name := range names {
+			if name != "" && name != "-" && utils.ToSnakeCase(name) == column {
+				return []int{i}, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,113 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/danielcomboni/generic-crud/utils"
+)
+
+// modelSettings holds the per-model configuration registered through the
+// Set* functions of this package.
+type modelSettings struct {
+	primaryKey         []string
+	sortableFields     map[string]bool
+	filterableFields   map[string]bool
+	groupableFields    map[string]bool
+	aggregatableFields map[string]bool
+	versionField       string
+	hooks              map[hookKey][]interface{}
+	auditTable         string
+	tenantColumn       string
+	searchableFields   []string
+	searchEngine       SearchEngine
+	searchIndex        string
+	cache              Cache
+	cacheTTL           time.Duration
+}
+
+var (
+	modelSettingsMu sync.RWMutex
+	modelSettingsOf = map[reflect.Type]*modelSettings{}
+)
+
+func modelType[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func updateModelSettings[T any](update func(s *modelSettings)) {
+	modelSettingsMu.Lock()
+	defer modelSettingsMu.Unlock()
+
+	t := modelType[T]()
+	s, ok := modelSettingsOf[t]
+	if !ok {
+		s = &modelSettings{}
+		modelSettingsOf[t] = s
+	}
+	update(s)
+}
+
+func getModelSettings[T any]() modelSettings {
+	modelSettingsMu.RLock()
+	defer modelSettingsMu.RUnlock()
+
+	if s, ok := modelSettingsOf[modelType[T]()]; ok {
+		return *s
+	}
+	return modelSettings{}
+}
+
+// repositoryOptionsKey carries the options of a repository of the model type
+// t through the context of its calls.
+type repositoryOptionsKey struct {
+	t reflect.Type
+}
+
+// withRepositoryOptions makes the options of a repository of T take
+// precedence, within ctx, over the settings registered with the Set*
+// functions, so that repositories of the same model can be configured
+// differently.
+func withRepositoryOptions[T any](ctx context.Context, options repositoryOptions) context.Context {
+	return context.WithValue(ctx, repositoryOptionsKey{t: modelType[T]()}, options)
+}
+
+// settingsOf returns the settings of T within ctx: the registered ones,
+// overridden by the options of the repository making the call.
+func settingsOf[T any](ctx context.Context) modelSettings {
+	s := getModelSettings[T]()
+	options, ok := ctx.Value(repositoryOptionsKey{t: modelType[T]()}).(repositoryOptions)
+	if !ok {
+		return s
+	}
+	if len(options.primaryKey) > 0 {
+		s.primaryKey = options.primaryKey
+	}
+	if options.tenantColumn != "" {
+		s.tenantColumn = utils.ToSnakeCase(options.tenantColumn)
+	}
+	if options.cache != nil {
+		s.cache, s.cacheTTL = options.cache, options.cacheTTL
+	}
+	return s
+}
+
+// fieldSet normalizes json field names so that "createdAt", "CreatedAt" and
+// "created_at" all refer to the same entry.
+func fieldSet(fields []string) map[string]bool {
+	set := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		set[utils.ToCamelCaseLower(f)] = true
+	}
+	return set
+}
+
+// SetSortableFields registers the json field names T may be sorted by. Sorting
+// by any other field is rejected.
+func SetSortableFields[T any](fields ...string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.sortableFields = fieldSet(fields)
+	})
+}
@@ -0,0 +1,80 @@
+package genericcrud_repositories_gorm
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// Pagination describes the page of a collection a single call should return.
+// It is passed explicitly to the list functions so that concurrent requests
+// never share paging state. When Cursor is set the page is found by seeking
+// past the row the cursor was issued for and Page is ignored. Filters narrow
+// the collection before it is counted and paged, and so does Search, which
+// also orders the rows by relevance before Sort.
+type Pagination struct {
+	Limit   int     `json:"limit"`
+	Page    int     `json:"page"`
+	Sort    string  `json:"sort"`
+	Cursor  string  `json:"cursor"`
+	Filters Filters `json:"filters"`
+	Search  string  `json:"search"`
+}
+
+func NewPagination(limit, page int, sort string) Pagination {
+	return Pagination{
+		Limit: limit,
+		Page:  page,
+		Sort:  sort,
+	}
+}
+
+// Normalized returns a copy of the pagination with the page defaulted to 1
+// and the limit clamped to the range the repository accepts.
+func (p Pagination) Normalized() Pagination {
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+
+	switch {
+	case p.Limit > maxPageSize:
+		p.Limit = maxPageSize
+	case p.Limit <= 0:
+		p.Limit = defaultPageSize
+	}
+	return p
+}
+
+func (p Pagination) params() (offset int, limit int) {
+	n := p.Normalized()
+	offset = (n.Page - 1) * n.Limit
+	return offset, n.Limit
+}
+
+// Page is one page of a collection together with the metadata clients need
+// to navigate the rest of it. Pages loaded through a cursor are not counted
+// and have a Total of -1.
+type Page[T any] struct {
+	Rows       []T    `json:"rows"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	TotalPages int    `json:"totalPages"`
+	HasNext    bool   `json:"hasNext"`
+	HasPrev    bool   `json:"hasPrev"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+func newPage[T any](rows []T, total int64, pagination Pagination) Page[T] {
+	n := pagination.Normalized()
+	totalPages := int((total + int64(n.Limit) - 1) / int64(n.Limit))
+	return Page[T]{
+		Rows:       rows,
+		Total:      total,
+		Page:       n.Page,
+		Limit:      n.Limit,
+		TotalPages: totalPages,
+		HasNext:    n.Page < totalPages,
+		HasPrev:    n.Page > 1,
+	}
+}
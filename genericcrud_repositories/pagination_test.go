@@ -0,0 +1,34 @@
+package genericcrud_repositories_gorm
+
+import "testing"
+
+func TestPaginationParams(t *testing.T) {
+	cases := []struct {
+		pagination    Pagination
+		offset, limit int
+	}{
+		{Pagination{}, 0, 10},
+		{Pagination{Page: 3, Limit: 20}, 40, 20},
+		{Pagination{Page: 2, Limit: 500}, 100, 100},
+		{Pagination{Page: -1, Limit: -5}, 0, 10},
+	}
+
+	for _, c := range cases {
+		offset, limit := c.pagination.params()
+		if offset != c.offset || limit != c.limit {
+			t.Errorf("%+v: got offset %v limit %v, want %v %v", c.pagination, offset, limit, c.offset, c.limit)
+		}
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	page := newPage([]int{1, 2}, 25, Pagination{Page: 2, Limit: 10})
+	if page.TotalPages != 3 || !page.HasNext || !page.HasPrev {
+		t.Errorf("unexpected page metadata: %+v", page)
+	}
+
+	last := newPage([]int{1}, 21, Pagination{Page: 3, Limit: 10})
+	if last.HasNext || last.TotalPages != 3 {
+		t.Errorf("unexpected page metadata: %+v", last)
+	}
+}
@@ -0,0 +1,228 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidPatch = withKind(ErrValidation, errors.New("invalid patch"))
+
+// MergePatchById applies an RFC 7396 JSON merge patch to the row of T with the
+// given id. The patched row is checked with validate, e.g. the Struct method of
+// a validator, and only the columns whose values changed are written, in a
+// single statement.
+func MergePatchById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, patch []byte, validate func(interface{}) error) (T, error) {
+	log.Println(fmt.Sprintf("\n\nmerge patching row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(patch, &object); err != nil || object == nil {
+		return *new(T), fmt.Errorf("%w: a merge patch of a record must be a json object", ErrInvalidPatch)
+	}
+
+	return patchById[T](ctx, databaseInstance, id, func(document []byte) ([]byte, error) {
+		return utils.ApplyMergePatch(document, patch)
+	}, validate)
+}
+
+// JSONPatchById applies the operations of an RFC 6902 JSON patch to the row of
+// T with the given id. A failing test operation aborts the whole patch with
+// utils.ErrJSONPatchTestFailed, which matches ErrConflict; nothing is written
+// unless every operation succeeds and the patched row passes validate, which
+// is required as for MergePatchById.
+func JSONPatchById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, patch []byte, validate func(interface{}) error) (T, error) {
+	log.Println(fmt.Sprintf("\n\njson patching row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
+
+	var operations []utils.JSONPatchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return *new(T), fmt.Errorf("%w: a json patch must be an array of operations", ErrInvalidPatch)
+	}
+
+	return patchById[T](ctx, databaseInstance, id, func(document []byte) ([]byte, error) {
+		patched, err := utils.ApplyJSONPatch(document, operations)
+		if errors.Is(err, utils.ErrJSONPatchTestFailed) {
+			return nil, withKind(ErrConflict, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		return patched, nil
+	}, validate)
+}
+
+// patchById loads the row, lets apply rewrite its json document and writes
+// back the members of the document that changed, all in one transaction with
+// the update hooks and the audit entry of T.
+func patchById[T any](ctx context.Context, databaseInstance *gorm.DB, id string, apply func(document []byte) ([]byte, error), validate func(interface{}) error) (T, error) {
+	if validate == nil {
+		return *new(T), fmt.Errorf("patching %v needs a validate function", reflect.TypeOf(*new(T)).Name())
+	}
+	ctx = transactionContext(ctx, databaseInstance)
+	defer invalidate[T](ctx)
+
+	var patched T
+
+	err := WithTransaction(ctx, databaseInstance, func(tx *gorm.DB) error {
+		one, err := getOneById[T](tx.Statement.Context, tx, id)
+		if err != nil {
+			return err
+		}
+
+		versionCondition, current, err := checkVersion[T](tx.Statement.Context, one, nil)
+		if err != nil {
+			return err
+		}
+
+		document, err := json.Marshal(one)
+		if err != nil {
+			return err
+		}
+		patchedDocument, err := apply(document)
+		if err != nil {
+			return err
+		}
+
+		merged, updates, err := changedColumns[T](ctx, tx, one, document, patchedDocument)
+		if err != nil {
+			return err
+		}
+
+		if err := validate(&merged); err != nil {
+			return err
+		}
+
+		if err := runHooks[T](tx.Statement.Context, hookUpdate, false, &one, &merged); err != nil {
+			return err
+		}
+
+		if len(updates) == 0 {
+			patched = one
+			return runHooks[T](tx.Statement.Context, hookUpdate, true, &one, &patched)
+		}
+
+		condition, err := byId[T](ctx, id)
+		if err != nil {
+			return err
+		}
+		instance := tx.Model(new(T)).Where(condition)
+		if versionCondition != nil {
+			updates[versionColumn[T]()] = current + 1
+			instance = instance.Where(versionCondition)
+		}
+
+		result := instance.Updates(updates)
+		if result.Error != nil {
+			return translateError[T](ctx, tx, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			if versionCondition != nil {
+				return concurrentConflict[T](ctx, tx, id, current)
+			}
+			return notFound[T](id)
+		}
+
+		patched, err = getOneById[T](tx.Statement.Context, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := runHooks[T](tx.Statement.Context, hookUpdate, true, &one, &patched); err != nil {
+			return err
+		}
+		return audit[T](tx.Statement.Context, tx, AuditPatch, &one, &patched)
+	})
+
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to patch: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return *new(T), err
+	}
+	return patched, nil
+}
+
+// changedColumns decodes the members that differ between the two json
+// documents of one into a copy of it, and returns that copy together with the
+// new values keyed by column. The columns the repository maintains itself,
+// the key, the tenant, the timestamps, the soft delete column and the version,
+// cannot be patched.
+func changedColumns[T any](ctx context.Context, databaseInstance *gorm.DB, one T, document, patchedDocument []byte) (T, map[string]interface{}, error) {
+	merged := one
+	updates := map[string]interface{}{}
+
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(document, &before); err != nil {
+		return merged, nil, err
+	}
+	if err := json.Unmarshal(patchedDocument, &after); err != nil || after == nil {
+		return merged, nil, fmt.Errorf("%w: the patched record must be a json object", ErrInvalidPatch)
+	}
+
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return merged, nil, err
+	}
+
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	target := reflect.ValueOf(&merged).Elem()
+	for key := range keys {
+		if jsonEqual(before[key], after[key]) {
+			continue
+		}
+
+		index, ok := structField(modelType[T](), key)
+		if !ok {
+			return merged, nil, fmt.Errorf("%w: %v has no field: %v", ErrInvalidPatch, sch.Name, key)
+		}
+		field := sch.LookUpField(modelType[T]().FieldByIndex(index).Name)
+		if field == nil || field.DBName == "" {
+			return merged, nil, fmt.Errorf("%w: %v cannot be patched", ErrInvalidPatch, key)
+		}
+		if field.PrimaryKey || isPrimaryKeyColumn[T](ctx, field.DBName) {
+			return merged, nil, fmt.Errorf("%w: the primary key cannot be patched", ErrInvalidPatch)
+		}
+		if isTenantColumn[T](ctx, field.DBName) {
+			return merged, nil, fmt.Errorf("%w: the tenant cannot be patched", ErrInvalidPatch)
+		}
+		if field.AutoCreateTime > 0 || field.AutoUpdateTime > 0 || field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) || field.DBName == versionColumn[T]() {
+			return merged, nil, fmt.Errorf("%w: %v cannot be patched", ErrInvalidPatch, key)
+		}
+
+		value := reflect.New(field.FieldType)
+		if raw, ok := after[key]; ok {
+			if err := json.Unmarshal(raw, value.Interface()); err != nil {
+				return merged, nil, fmt.Errorf("%w: invalid value for %v: %v", ErrInvalidPatch, key, err)
+			}
+		}
+
+		target.FieldByIndex(index).Set(value.Elem())
+		updates[field.DBName] = value.Elem().Interface()
+	}
+	return merged, updates, nil
+}
+
+// jsonEqual compares two json values; a missing value equals null.
+func jsonEqual(a, b json.RawMessage) bool {
+	if a == nil {
+		a = json.RawMessage("null")
+	}
+	if b == nil {
+		b = json.RawMessage("null")
+	}
+
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -0,0 +1,101 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type patchedArticle struct {
+	Id        uint           `gorm:"primaryKey" json:"id"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Views     int            `json:"views"`
+	Version   int64          `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+func validArticle(row interface{}) error {
+	if row.(*patchedArticle).Title == "" {
+		return errors.New("title is required")
+	}
+	return nil
+}
+
+// openArticles returns a database holding one article and the statements of
+// the updates run against it.
+func openArticles(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	SetVersionField[patchedArticle]("version")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&patchedArticle{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&patchedArticle{Title: "a", Body: "body", Views: 3})
+
+	var statements []string
+	err := db.Callback().Update().After("gorm:update").Register("test:statements", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &statements
+}
+
+func TestMergePatchWritesChangedColumns(t *testing.T) {
+	db, statements := openArticles(t)
+
+	patched, err := MergePatchById[patchedArticle](ctx, db, "1", []byte(`{"title": "b", "body": "body", "views": null}`), validArticle)
+	if err != nil || patched.Title != "b" || patched.Body != "body" || patched.Views != 0 || patched.Version != 1 {
+		t.Fatalf("unexpected patch: %+v %v", patched, err)
+	}
+	if len(*statements) != 1 || strings.Contains((*statements)[0], "`body`") || !strings.Contains((*statements)[0], "`views`") {
+		t.Errorf("expected a single statement writing the changed columns only, got %v", *statements)
+	}
+}
+
+func TestPatchRefusesMaintainedColumns(t *testing.T) {
+	db, statements := openArticles(t)
+
+	for _, patch := range []string{
+		`{"id": 2}`,
+		`{"version": 7}`,
+		`{"createdAt": "2020-01-01T00:00:00Z"}`,
+		`{"updatedAt": "2020-01-01T00:00:00Z"}`,
+		`{"deletedAt": "2020-01-01T00:00:00Z"}`,
+	} {
+		if _, err := MergePatchById[patchedArticle](ctx, db, "1", []byte(patch), validArticle); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("%v: expected the patch to be refused, got %v", patch, err)
+		}
+	}
+	if _, err := JSONPatchById[patchedArticle](ctx, db, "1", []byte(`[{"op": "replace", "path": "/deletedAt", "value": "2020-01-01T00:00:00Z"}]`), validArticle); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("expected the json patch to be refused, got %v", err)
+	}
+	if len(*statements) != 0 {
+		t.Errorf("expected nothing to be written, got %v", *statements)
+	}
+}
+
+func TestPatchValidatesThePatchedRow(t *testing.T) {
+	db, statements := openArticles(t)
+
+	if _, err := MergePatchById[patchedArticle](ctx, db, "1", []byte(`{"title": "b"}`), nil); err == nil {
+		t.Error("expected a patch without validation to be refused")
+	}
+	if _, err := MergePatchById[patchedArticle](ctx, db, "1", []byte(`{"title": null}`), validArticle); err == nil || err.Error() != "title is required" {
+		t.Errorf("expected the validation error, got %v", err)
+	}
+	_, err := JSONPatchById[patchedArticle](ctx, db, "1", []byte(`[{"op": "test", "path": "/title", "value": "x"}, {"op": "replace", "path": "/title", "value": "b"}]`), validArticle)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expected the failed test to conflict, got %v", err)
+	}
+	if len(*statements) != 0 {
+		t.Errorf("expected nothing to be written, got %v", *statements)
+	}
+}
@@ -0,0 +1,205 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// IdSeparator joins the values of a composite primary key into one id, e.g.
+// "acme/SKU-1" for a key of (tenant_id, sku).
+const IdSeparator = "/"
+
+// ErrInvalidId is returned for ids that do not fit the primary key of a model.
+var ErrInvalidId = withKind(ErrValidation, errors.New("invalid id"))
+
+// SetPrimaryKey sets the columns T is looked up, updated and deleted by; more
+// than one column makes a composite key. Without it the key is taken from
+// the gorm primaryKey tags of T, and defaults to "id".
+func SetPrimaryKey[T any](columns ...string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.primaryKey = columns
+	})
+}
+
+// PrimaryKeyColumns returns the primary key columns of T in key order.
+func PrimaryKeyColumns[T any]() []string {
+	return primaryKeyColumns[T](context.Background())
+}
+
+// primaryKeyColumns returns the primary key columns of T within ctx, where a
+// repository may have set a key of its own.
+func primaryKeyColumns[T any](ctx context.Context) []string {
+	if columns := settingsOf[T](ctx).primaryKey; len(columns) > 0 {
+		return columns
+	}
+	if columns := taggedPrimaryKey(modelType[T]()); len(columns) > 0 {
+		return columns
+	}
+	return []string{"id"}
+}
+
+// taggedPrimaryKey finds the columns of the fields of t tagged as gorm
+// primary keys, looking into embedded structs such as gorm.Model.
+func taggedPrimaryKey(t reflect.Type) []string {
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			columns = append(columns, taggedPrimaryKey(f.Type)...)
+			continue
+		}
+
+		column, primaryKey := utils.ToSnakeCase(f.Name), false
+		for _, setting := range strings.Split(f.Tag.Get("gorm"), ";") {
+			name, value, _ := strings.Cut(setting, ":")
+			switch strings.ToUpper(strings.TrimSpace(name)) {
+			case "PRIMARYKEY", "PRIMARY_KEY":
+				primaryKey = true
+			case "COLUMN":
+				column = value
+			}
+		}
+		if primaryKey {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// isPrimaryKeyColumn reports whether column is part of the primary key of T.
+func isPrimaryKeyColumn[T any](ctx context.Context, column string) bool {
+	for _, key := range primaryKeyColumns[T](ctx) {
+		if utils.ToSnakeCase(key) == utils.ToSnakeCase(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseId splits id into the values of the primary key columns of T,
+// converted to the go types of their fields.
+func ParseId[T any](id string) ([]interface{}, error) {
+	return parseId[T](context.Background(), id)
+}
+
+func parseId[T any](ctx context.Context, id string) ([]interface{}, error) {
+	columns := primaryKeyColumns[T](ctx)
+	parts := strings.SplitN(id, IdSeparator, len(columns))
+	if len(parts) != len(columns) {
+		return nil, fmt.Errorf("%w: %v needs %v values separated by %v: %v", ErrInvalidId, modelType[T]().Name(), len(columns), IdSeparator, id)
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		index, ok := structField(modelType[T](), column)
+		if !ok {
+			return nil, fmt.Errorf("%v has no primary key field: %v", modelType[T]().Name(), column)
+		}
+		if parts[i] == "" {
+			return nil, fmt.Errorf("%w: empty %v", ErrInvalidId, column)
+		}
+
+		value, err := convertValue(modelType[T]().FieldByIndex(index).Type, parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v is not a valid %v", ErrInvalidId, parts[i], column)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// IdOf returns the id of row: the values of its primary key joined with
+// IdSeparator.
+func IdOf[T any](row T) string {
+	return idOf(context.Background(), row)
+}
+
+func idOf[T any](ctx context.Context, row T) string {
+	columns := primaryKeyColumns[T](ctx)
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if index, ok := structField(modelType[T](), column); ok {
+			parts[i] = fmt.Sprint(reflect.Indirect(reflect.ValueOf(row).FieldByIndex(index)).Interface())
+		}
+	}
+	return strings.Join(parts, IdSeparator)
+}
+
+// HasPrimaryKey reports whether row was loaded from or saved to the
+// database, that is whether every column of its primary key is set. Zero is a
+// valid value of number columns, e.g. a tenant_id of 0 in a composite key,
+// unless the database fills the column in on insert: a lone integer primary
+// key, or a column tagged autoIncrement, as gorm reads them.
+func HasPrimaryKey[T any](row T) bool {
+	return hasPrimaryKey(context.Background(), row)
+}
+
+func hasPrimaryKey[T any](ctx context.Context, row T) bool {
+	for _, column := range primaryKeyColumns[T](ctx) {
+		index, ok := structField(modelType[T](), column)
+		if !ok {
+			return false
+		}
+		value := reflect.ValueOf(row).FieldByIndex(index)
+		if value.IsZero() && (!isNumberKind(value.Kind()) || autoIncrement[T](column)) {
+			return false
+		}
+	}
+	return true
+}
+
+// keySchemas caches the schemas autoIncrement parses.
+var keySchemas sync.Map
+
+// autoIncrement reports whether gorm reads column of T as auto incremented.
+func autoIncrement[T any](column string) bool {
+	sch, err := schema.Parse(new(T), &keySchemas, schema.NamingStrategy{})
+	if err != nil {
+		return false
+	}
+	field := sch.LookUpField(utils.ToSnakeCase(column))
+	return field != nil && field.AutoIncrement
+}
+
+// byId is the condition selecting the row of T with the given id.
+func byId[T any](ctx context.Context, id string) (clause.Expression, error) {
+	values, err := parseId[T](ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := primaryKeyColumns[T](ctx)
+	conditions := make([]clause.Expression, len(columns))
+	for i, column := range columns {
+		conditions[i] = clause.Eq{Column: clause.Column{Name: column}, Value: values[i]}
+	}
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return clause.And(conditions...), nil
+}
+
+// canonicalId checks that id fits the primary key of T and rewrites it the way
+// IdOf prints keys.
+func canonicalId[T any](ctx context.Context, id string) (string, error) {
+	values, err := parseId[T](ctx, id)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, IdSeparator), nil
+}
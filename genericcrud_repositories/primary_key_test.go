@@ -0,0 +1,110 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type codeModel struct {
+	Code int    `gorm:"primaryKey" json:"code"`
+	Name string `json:"name"`
+}
+
+type stockModel struct {
+	TenantId string `gorm:"primaryKey;column:tenant_id" json:"tenantId"`
+	Sku      string `gorm:"primary_key" json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type regionStockModel struct {
+	RegionId int    `gorm:"primaryKey" json:"regionId"`
+	Sku      string `gorm:"primaryKey" json:"sku"`
+}
+
+type fixedCodeModel struct {
+	Code int `gorm:"primaryKey;autoIncrement:false" json:"code"`
+}
+
+type embeddedKeyModel struct {
+	gorm.Model
+	Name string
+}
+
+func TestPrimaryKeyColumns(t *testing.T) {
+	cases := []struct {
+		got, want []string
+	}{
+		{PrimaryKeyColumns[codeModel](), []string{"code"}},
+		{PrimaryKeyColumns[stockModel](), []string{"tenant_id", "sku"}},
+		{PrimaryKeyColumns[embeddedKeyModel](), []string{"id"}},
+		{PrimaryKeyColumns[memoryHardModel](), []string{"id"}},
+	}
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("got %v, want %v", c.got, c.want)
+		}
+	}
+}
+
+func TestParseId(t *testing.T) {
+	values, err := ParseId[codeModel]("7")
+	if err != nil || !reflect.DeepEqual(values, []interface{}{7}) {
+		t.Errorf("unexpected integer id: %#v %v", values, err)
+	}
+	if _, err := ParseId[codeModel]("abc"); !errors.Is(err, ErrInvalidId) {
+		t.Errorf("expected an invalid id, got %v", err)
+	}
+
+	values, err = ParseId[stockModel]("acme/SKU-1")
+	if err != nil || !reflect.DeepEqual(values, []interface{}{"acme", "SKU-1"}) {
+		t.Errorf("unexpected composite id: %#v %v", values, err)
+	}
+	if _, err := ParseId[stockModel]("acme"); !errors.Is(err, ErrInvalidId) {
+		t.Errorf("expected a composite id with one value to be invalid, got %v", err)
+	}
+
+	if id := IdOf(stockModel{TenantId: "acme", Sku: "SKU-1"}); id != "acme/SKU-1" {
+		t.Errorf("unexpected id: %v", id)
+	}
+	if HasPrimaryKey(stockModel{TenantId: "acme"}) {
+		t.Error("expected a partly set composite key not to count as set")
+	}
+}
+
+func TestHasPrimaryKeyOfZero(t *testing.T) {
+	if !HasPrimaryKey(regionStockModel{Sku: "SKU-1"}) {
+		t.Error("expected a zero column of a composite key to count as set")
+	}
+	if !HasPrimaryKey(fixedCodeModel{}) {
+		t.Error("expected a zero key that is not auto incremented to count as set")
+	}
+	if HasPrimaryKey(codeModel{}) || HasPrimaryKey(embeddedKeyModel{}) {
+		t.Error("expected a zero auto incremented key not to count as set")
+	}
+}
+
+func TestMemoryRepositoryCompositeKey(t *testing.T) {
+	r := NewMemoryRepository[stockModel]()
+	if _, err := r.Create(ctx, stockModel{Quantity: 1}); err == nil {
+		t.Error("expected creating a row without its composite key to fail")
+	}
+
+	_, _ = r.Create(ctx, stockModel{TenantId: "acme", Sku: "a", Quantity: 1})
+	_, _ = r.Create(ctx, stockModel{TenantId: "acme", Sku: "b", Quantity: 2})
+
+	one, err := r.GetOneById(ctx, "acme/b")
+	if err != nil || one.Quantity != 2 {
+		t.Errorf("unexpected row: %+v %v", one, err)
+	}
+	if n, err := r.DeletePermanentById(ctx, "acme/a"); n != 1 || err != nil {
+		t.Errorf("delete: %v %v", n, err)
+	}
+
+	codes := NewMemoryRepository[codeModel]()
+	if _, err := codes.GetOneById(ctx, "x"); !errors.Is(err, ErrInvalidId) {
+		t.Errorf("expected a non integer id to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repository is the set of operations services need on a model. It lets
+// services depend on an interface that can be replaced by a fake in tests.
+// Every operation runs within the given context.
+type Repository[T any] interface {
+	Create(ctx context.Context, model T) (T, error)
+	CreateBatch(ctx context.Context, models []T) ([]T, error)
+	GetAll(ctx context.Context, pagination Pagination) (Page[T], error)
+	GetAllByFields(ctx context.Context, pagination Pagination, queryMap map[string]interface{}) (Page[T], error)
+	GetOneById(ctx context.Context, id string) (T, error)
+	GetOneSoftDeletedById(ctx context.Context, id string) (T, error)
+	UpdateById(ctx context.Context, t T, id string) (T, error)
+	PatchById(ctx context.Context, id, columnName string, value interface{}) (T, error)
+	// Delete removes a row the way the repository was configured to:
+	// softly by default, permanently otherwise.
+	Delete(ctx context.Context, id string) (int64, error)
+	DeleteSoftById(ctx context.Context, id string) (int64, error)
+	DeleteHardById(ctx context.Context, id string) (int64, error)
+	DeletePermanentById(ctx context.Context, id string) (int64, error)
+	RestoreById(ctx context.Context, id string) (T, error)
+	GetAllSoftDeleted(ctx context.Context, pagination Pagination) (Page[T], error)
+	UpdateWhere(ctx context.Context, filter BulkFilter, values map[string]interface{}) (int64, error)
+	DeleteSoftWhere(ctx context.Context, filter BulkFilter) (int64, error)
+	DeleteHardWhere(ctx context.Context, filter BulkFilter) (int64, error)
+}
+
+type repositoryOptions struct {
+	primaryKey   []string
+	preloads     []string
+	softDelete   bool
+	tenantColumn string
+	cache        Cache
+	cacheTTL     time.Duration
+}
+
+type RepositoryOption func(options *repositoryOptions)
+
+// WithPrimaryKey sets the primary key columns of the model, see SetPrimaryKey.
+// Like the other options it holds for the repository it is given to only, so
+// that repositories of the same model can be configured differently; the
+// handlers of genericcontrollers_gorm_gin read ids with the registered key.
+func WithPrimaryKey(columns ...string) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.primaryKey = columns
+	}
+}
+
+// WithTenantColumn scopes the model by tenant, see SetTenantColumn.
+func WithTenantColumn(column string) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.tenantColumn = column
+	}
+}
+
+// WithCache makes the reads of the model go through cache, see SetCache.
+func WithCache(cache Cache, ttl time.Duration) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.cache, options.cacheTTL = cache, ttl
+	}
+}
+
+// WithPreloads sets the associations loaded with every read.
+func WithPreloads(preloads ...string) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.preloads = preloads
+	}
+}
+
+// WithSoftDelete sets whether Delete keeps the row as soft deleted (the
+// default) or removes it permanently.
+func WithSoftDelete(softDelete bool) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.softDelete = softDelete
+	}
+}
+
+// GormRepository is the Repository backed by the functions of this package.
+type GormRepository[T any] struct {
+	databaseInstance *gorm.DB
+	options          repositoryOptions
+}
+
+var _ Repository[struct{}] = (*GormRepository[struct{}])(nil)
+
+func NewGormRepository[T any](databaseInstance *gorm.DB, options ...RepositoryOption) *GormRepository[T] {
+	o := repositoryOptions{softDelete: true}
+	for _, option := range options {
+		option(&o)
+	}
+
+	return &GormRepository[T]{
+		databaseInstance: databaseInstance,
+		options:          o,
+	}
+}
+
+// context carries the options of r through ctx, where they take precedence
+// over the settings registered for T.
+func (r *GormRepository[T]) context(ctx context.Context) context.Context {
+	return withRepositoryOptions[T](ctx, r.options)
+}
+
+func (r *GormRepository[T]) Create(ctx context.Context, model T) (T, error) {
+	return Create[T](r.context(ctx), &model, r.databaseInstance)
+}
+
+func (r *GormRepository[T]) CreateBatch(ctx context.Context, models []T) ([]T, error) {
+	return CreateBatch[T](r.context(ctx), models, r.databaseInstance)
+}
+
+func (r *GormRepository[T]) GetAll(ctx context.Context, pagination Pagination) (Page[T], error) {
+	return GetAllByFields[T](r.context(ctx), r.databaseInstance, pagination, map[string]interface{}{}, r.options.preloads...)
+}
+
+func (r *GormRepository[T]) GetAllByFields(ctx context.Context, pagination Pagination, queryMap map[string]interface{}) (Page[T], error) {
+	return GetAllByFields[T](r.context(ctx), r.databaseInstance, pagination, queryMap, r.options.preloads...)
+}
+
+func (r *GormRepository[T]) GetOneById(ctx context.Context, id string) (T, error) {
+	return GetOneById[T](r.context(ctx), r.databaseInstance, id, r.options.preloads...)
+}
+
+func (r *GormRepository[T]) GetOneSoftDeletedById(ctx context.Context, id string) (T, error) {
+	return GetOneSoftDeletedById[T](r.context(ctx), r.databaseInstance, id, r.options.preloads...)
+}
+
+func (r *GormRepository[T]) UpdateById(ctx context.Context, t T, id string) (T, error) {
+	return UpdateById[T](r.context(ctx), r.databaseInstance, t, id)
+}
+
+func (r *GormRepository[T]) PatchById(ctx context.Context, id, columnName string, value interface{}) (T, error) {
+	return PatchById[T](r.context(ctx), r.databaseInstance, id, columnName, value)
+}
+
+func (r *GormRepository[T]) Delete(ctx context.Context, id string) (int64, error) {
+	if r.options.softDelete {
+		return r.DeleteSoftById(ctx, id)
+	}
+	return r.DeletePermanentById(ctx, id)
+}
+
+func (r *GormRepository[T]) DeleteSoftById(ctx context.Context, id string) (int64, error) {
+	return DeleteSoftById[T](r.context(ctx), r.databaseInstance, id)
+}
+
+func (r *GormRepository[T]) DeleteHardById(ctx context.Context, id string) (int64, error) {
+	return DeleteHardById[T](r.context(ctx), r.databaseInstance, id)
+}
+
+func (r *GormRepository[T]) DeletePermanentById(ctx context.Context, id string) (int64, error) {
+	return DeletePermanentById[T](r.context(ctx), r.databaseInstance, id)
+}
+
+func (r *GormRepository[T]) RestoreById(ctx context.Context, id string) (T, error) {
+	return RestoreById[T](r.context(ctx), r.databaseInstance, id)
+}
+
+func (r *GormRepository[T]) GetAllSoftDeleted(ctx context.Context, pagination Pagination) (Page[T], error) {
+	return GetAllSoftDeleted[T](r.context(ctx), r.databaseInstance, pagination, r.options.preloads...)
+}
+
+func (r *GormRepository[T]) UpdateWhere(ctx context.Context, filter BulkFilter, values map[string]interface{}) (int64, error) {
+	return UpdateWhere[T](r.context(ctx), r.databaseInstance, filter, values)
+}
+
+func (r *GormRepository[T]) DeleteSoftWhere(ctx context.Context, filter BulkFilter) (int64, error) {
+	return DeleteSoftWhere[T](r.context(ctx), r.databaseInstance, filter)
+}
+
+func (r *GormRepository[T]) DeleteHardWhere(ctx context.Context, filter BulkFilter) (int64, error) {
+	return DeleteHardWhere[T](r.context(ctx), r.databaseInstance, filter)
+}
+
+// GetHistoryById is not part of Repository: only the gorm functions audit.
+func (r *GormRepository[T]) GetHistoryById(ctx context.Context, id string, pagination Pagination) (Page[AuditEntry], error) {
+	return GetHistoryById[T](r.context(ctx), r.databaseInstance, id, pagination)
+}
+
+// Aggregate is not part of Repository: only the gorm functions aggregate.
+func (r *GormRepository[T]) Aggregate(ctx context.Context, aggregation Aggregation) ([]AggregateRow, error) {
+	return Aggregate[T](r.context(ctx), r.databaseInstance, aggregation)
+}
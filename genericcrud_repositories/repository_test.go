@@ -0,0 +1,77 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type ledgerEntry struct {
+	Id      uint   `gorm:"primaryKey" json:"id"`
+	Account string `gorm:"uniqueIndex:idx_entry" json:"account"`
+	Number  string `gorm:"uniqueIndex:idx_entry" json:"number"`
+	Tenant  string `json:"tenant"`
+	Amount  int    `json:"amount"`
+}
+
+func TestGormRepositoriesOfTheSameModel(t *testing.T) {
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&ledgerEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]ledgerEntry{{Account: "cash", Number: "1", Tenant: "acme", Amount: 5}, {Account: "cash", Number: "2", Tenant: "other", Amount: 7}})
+
+	byId := NewGormRepository[ledgerEntry](db)
+	byNumber := NewGormRepository[ledgerEntry](db, WithPrimaryKey("account", "number"), WithTenantColumn("tenant"))
+
+	if row, err := byId.GetOneById(ctx, "2"); err != nil || row.Amount != 7 {
+		t.Errorf("expected the row of id 2 without a tenant, got %+v %v", row, err)
+	}
+	if _, err := byId.GetOneById(ctx, "cash/1"); !errors.Is(err, ErrInvalidId) {
+		t.Errorf("expected the key of the other repository to be invalid, got %v", err)
+	}
+
+	acme := WithTenant(ctx, "acme")
+	if row, err := byNumber.GetOneById(acme, "cash/1"); err != nil || row.Amount != 5 {
+		t.Errorf("expected the row of number 1, got %+v %v", row, err)
+	}
+	if _, err := byNumber.GetOneById(acme, "cash/2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the row of another tenant not to be found, got %v", err)
+	}
+	if _, err := byNumber.GetOneById(ctx, "cash/1"); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected a tenant to be required, got %v", err)
+	}
+	if row, err := byNumber.PatchById(acme, "cash/1", "amount", 6); err != nil || row.Amount != 6 {
+		t.Errorf("expected the amount to be patched, got %+v %v", row, err)
+	}
+
+	if columns := PrimaryKeyColumns[ledgerEntry](); len(columns) != 1 || columns[0] != "id" {
+		t.Errorf("expected the registered key to be left alone, got %v", columns)
+	}
+}
+
+func TestGormRepositoryCacheIsItsOwn(t *testing.T) {
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&ledgerEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&ledgerEntry{Account: "cash", Number: "1", Amount: 5})
+
+	cache := NewLRUCache(100)
+	uncached := NewGormRepository[ledgerEntry](db)
+	cached := NewGormRepository[ledgerEntry](db, WithCache(cache, time.Minute))
+
+	if _, err := uncached.GetOneById(ctx, "1"); err != nil || cache.Len() != 0 {
+		t.Fatalf("expected the read to bypass the cache of the other repository, got %v entries %v", cache.Len(), err)
+	}
+	if _, err := cached.GetOneById(ctx, "1"); err != nil || cache.Len() == 0 {
+		t.Fatalf("expected the read to be cached, got %v entries %v", cache.Len(), err)
+	}
+
+	if _, err := cached.PatchById(ctx, "1", "amount", 6); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := cached.GetOneById(ctx, "1"); err != nil || row.Amount != 6 {
+		t.Errorf("expected the write to invalidate the cache, got %+v %v", row, err)
+	}
+}
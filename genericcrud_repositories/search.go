@@ -0,0 +1,230 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchEngine is the way the searchable fields of a model are searched.
+type SearchEngine int
+
+const (
+	// SearchLike matches every word of the search in any searchable column
+	// with a case insensitive LIKE, ranking rows by the number of matches. It
+	// needs no setup and works on every database.
+	SearchLike SearchEngine = iota
+	// SearchPostgres matches the words, as prefixes, against the tsvector of
+	// the searchable columns and ranks rows with ts_rank.
+	SearchPostgres
+	// SearchSQLite matches the words, as prefixes, in an FTS5 table and ranks
+	// rows by its bm25 rank.
+	SearchSQLite
+)
+
+// SetSearchableFields registers the json string fields of T a search of its
+// lists looks into. Searching a model without searchable fields is rejected.
+func SetSearchableFields[T any](fields ...string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.searchableFields = fields
+	})
+}
+
+// SetPostgresSearch makes the searches of T use Postgres full text search
+// with the given text search configuration, e.g. "english"; it defaults to
+// "simple". An expression index on the tsvector of the searchable columns keeps
+// it fast.
+func SetPostgresSearch[T any](config string) {
+	if config == "" {
+		config = "simple"
+	}
+	updateModelSettings[T](func(s *modelSettings) {
+		s.searchEngine = SearchPostgres
+		s.searchIndex = config
+	})
+}
+
+// SetSQLiteSearch makes the searches of T match in the FTS5 table, whose rowid
+// must be the integer primary key of T, e.g. an external content table created
+// with USING fts5(name, description, content='items', content_rowid='id') and
+// kept up to date by triggers. All the columns of the table are searched.
+// Until the table exists, e.g. on a build of SQLite without FTS5, searches fall
+// back to SearchLike.
+func SetSQLiteSearch[T any](table string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.searchEngine = SearchSQLite
+		s.searchIndex = table
+	})
+}
+
+// Search pages through the rows of T matching the words of q in its searchable
+// fields, most relevant first; the sort of pagination, if any, breaks ties. It
+// is GetAllByFields with pagination.Search set to q.
+func Search[T any](ctx context.Context, databaseInstance *gorm.DB, q string, pagination Pagination, queryMap map[string]interface{}, preloads ...string) (Page[T], error) {
+	pagination.Search = q
+	return GetAllByFields[T](ctx, databaseInstance, pagination, queryMap, preloads...)
+}
+
+// searchTerms splits a search into its words.
+func searchTerms(search string) []string {
+	return strings.Fields(search)
+}
+
+// validateSearch checks that T can be searched the way pagination asks for.
+func validateSearch[T any](pagination Pagination) error {
+	if len(searchTerms(pagination.Search)) == 0 {
+		return nil
+	}
+
+	fields := getModelSettings[T]().searchableFields
+	if len(fields) == 0 {
+		return withKind(ErrValidation, fmt.Errorf("cannot search %v", modelType[T]().Name()))
+	}
+	if pagination.Cursor != "" {
+		return withKind(ErrValidation, fmt.Errorf("search results of %v are paged by page, not cursor", modelType[T]().Name()))
+	}
+	for _, field := range fields {
+		index, ok := structField(modelType[T](), field)
+		if !ok || indirectType(modelType[T]().FieldByIndex(index).Type).Kind() != reflect.String {
+			return fmt.Errorf("%v has no searchable string field: %v", modelType[T]().Name(), field)
+		}
+	}
+	return nil
+}
+
+// searchHandler keeps the rows of the query matching the search of pagination
+// and returns the expression ordering them by relevance, or nil without a
+// search.
+func searchHandler[T any](ctx context.Context, databaseInstance *gorm.DB, pagination Pagination) (*gorm.DB, clause.Expression, error) {
+	terms := searchTerms(pagination.Search)
+	if len(terms) == 0 {
+		return databaseInstance, nil, nil
+	}
+	if err := validateSearch[T](pagination); err != nil {
+		return databaseInstance, nil, err
+	}
+
+	settings := getModelSettings[T]()
+	var columns []clause.Column
+	for _, field := range settings.searchableFields {
+		columns = append(columns, clause.Column{Name: utils.ToSnakeCase(field)})
+	}
+
+	switch settings.searchEngine {
+	case SearchPostgres:
+		instance, rank := postgresSearch(databaseInstance, columns, settings.searchIndex, terms)
+		return instance, rank, nil
+	case SearchSQLite:
+		if databaseInstance.Session(&gorm.Session{NewDB: true}).Migrator().HasTable(settings.searchIndex) {
+			return sqliteSearch[T](ctx, databaseInstance, settings.searchIndex, terms)
+		}
+		log.Println(fmt.Sprintf("no fts5 table: %v, searching %v with like", settings.searchIndex, modelType[T]().Name()))
+	}
+	instance, rank := likeSearch(databaseInstance, columns, terms)
+	return instance, rank, nil
+}
+
+// likePattern matches value anywhere in a string; "!" escapes the wildcards,
+// as backslashes are not portable.
+func likePattern(value string) string {
+	value = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(value))
+	return "%" + value + "%"
+}
+
+func likeSearch(databaseInstance *gorm.DB, columns []clause.Column, terms []string) (*gorm.DB, clause.Expression) {
+	var ranks []string
+	var rankVars []interface{}
+	for _, term := range terms {
+		var ors []string
+		var vars []interface{}
+		for _, column := range columns {
+			ors = append(ors, "LOWER(?) LIKE ? ESCAPE '!'")
+			vars = append(vars, column, likePattern(term))
+		}
+		databaseInstance = databaseInstance.Where(clause.Expr{SQL: "(" + strings.Join(ors, " OR ") + ")", Vars: vars})
+
+		for _, column := range columns {
+			ranks = append(ranks, "CASE WHEN LOWER(?) LIKE ? ESCAPE '!' THEN 1 ELSE 0 END")
+			rankVars = append(rankVars, column, likePattern(term))
+		}
+	}
+	return databaseInstance, clause.Expr{SQL: "(" + strings.Join(ranks, " + ") + ") DESC", Vars: rankVars}
+}
+
+func postgresSearch(databaseInstance *gorm.DB, columns []clause.Column, config string, terms []string) (*gorm.DB, clause.Expression) {
+	var parts []string
+	var documentVars []interface{}
+	for _, column := range columns {
+		parts = append(parts, "coalesce(?, '')")
+		documentVars = append(documentVars, column)
+	}
+
+	// every word is quoted as a lexeme so that the search cannot be read as
+	// tsquery operators
+	lexemes := make([]string, len(terms))
+	for i, term := range terms {
+		lexemes[i] = "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(term) + "':*"
+	}
+	query := strings.Join(lexemes, " & ")
+
+	document := "to_tsvector(?::regconfig, " + strings.Join(parts, " || ' ' || ") + ")"
+	vars := append([]interface{}{config}, documentVars...)
+	vars = append(vars, config, query)
+
+	return databaseInstance.Where(clause.Expr{SQL: document + " @@ to_tsquery(?::regconfig, ?)", Vars: vars}),
+		clause.Expr{SQL: "ts_rank(" + document + ", to_tsquery(?::regconfig, ?)) DESC", Vars: vars}
+}
+
+func sqliteSearch[T any](ctx context.Context, databaseInstance *gorm.DB, table string, terms []string) (*gorm.DB, clause.Expression, error) {
+	keys := primaryKeyColumns[T](ctx)
+	if len(keys) != 1 {
+		return databaseInstance, nil, fmt.Errorf("%v needs a single integer primary key to be searched with fts5", modelType[T]().Name())
+	}
+	key := clause.Column{Table: clause.CurrentTable, Name: keys[0]}
+
+	// every word is quoted as a string so that the search cannot be read as
+	// fts5 operators
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	match := strings.Join(phrases, " ")
+	index := clause.Table{Name: table}
+
+	return databaseInstance.Where(clause.Expr{SQL: "? IN (SELECT rowid FROM ? WHERE ? MATCH ?)", Vars: []interface{}{key, index, index, match}}),
+		clause.Expr{SQL: "(SELECT rank FROM ? WHERE ? MATCH ? AND rowid = ?)", Vars: []interface{}{index, index, match, key}}, nil
+}
+
+// searchRank is the number of matches of the words of search in the searchable
+// fields of row, and zero when one of the words matches none of them. It is how
+// the in-memory repository searches, whatever the engine of T.
+func searchRank[T any](row *T, search string) int {
+	rank := 0
+	for _, term := range searchTerms(search) {
+		matches := 0
+		for _, field := range getModelSettings[T]().searchableFields {
+			index, ok := structField(modelType[T](), field)
+			if !ok {
+				continue
+			}
+			value := reflect.ValueOf(row).Elem().FieldByIndex(index)
+			for value.Kind() == reflect.Ptr && !value.IsNil() {
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.String && strings.Contains(strings.ToLower(value.String()), strings.ToLower(term)) {
+				matches++
+			}
+		}
+		if matches == 0 {
+			return 0
+		}
+		rank += matches
+	}
+	return rank
+}
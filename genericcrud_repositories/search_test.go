@@ -0,0 +1,142 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type searchModel struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func TestLikePattern(t *testing.T) {
+	if p := likePattern("50%_Off!"); p != "%50!%!_off!!%" {
+		t.Errorf("unexpected pattern: %v", p)
+	}
+}
+
+func TestMemoryRepositorySearch(t *testing.T) {
+	r := NewMemoryRepository[searchModel]()
+	if _, err := r.GetAll(ctx, Pagination{Search: "go"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a validation error, got: %v", err)
+	}
+
+	SetSearchableFields[searchModel]("title", "body")
+	r.CreateBatch(ctx, []searchModel{
+		{Title: "Rust", Body: "go away"},
+		{Title: "Cooking", Body: "pasta"},
+		{Title: "Go generics", Body: "generics in go"},
+	})
+
+	page, err := r.GetAll(ctx, Pagination{Search: "GO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Rows[0].Title != "Go generics" || page.Rows[1].Title != "Rust" {
+		t.Errorf("unexpected search results: %+v", page.Rows)
+	}
+
+	page, _ = r.GetAll(ctx, Pagination{Search: "go pasta"})
+	if page.Total != 0 {
+		t.Errorf("expected every word to match, got: %+v", page.Rows)
+	}
+}
+
+type indexedBook struct {
+	Id    uint   `gorm:"primaryKey" json:"id"`
+	Title string `json:"title"`
+	Blurb string `json:"blurb"`
+}
+
+// openBooks returns a database holding the books with the given titles and
+// blurbs, whose searches are sorted by title.
+func openBooks(t *testing.T, books ...indexedBook) *gorm.DB {
+	t.Helper()
+	SetSortableFields[indexedBook]("title")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&indexedBook{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&books)
+	return db
+}
+
+// searched are the titles of the books matching q, most relevant first.
+func searched(t *testing.T, db *gorm.DB, q string) string {
+	t.Helper()
+	page, err := Search[indexedBook](ctx, db, q, Pagination{Sort: "title"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, row := range page.Rows {
+		result = append(result, row.Title)
+	}
+	return fmt.Sprint(result)
+}
+
+func TestSearchLike(t *testing.T) {
+	SetSearchableFields[indexedBook]("title", "blurb")
+	t.Cleanup(func() { SetSearchableFields[indexedBook]() })
+	db := openBooks(t,
+		indexedBook{Title: "Go generics", Blurb: "types"},
+		indexedBook{Title: "Rust", Blurb: "ownership"},
+		indexedBook{Title: "Go in practice", Blurb: "GO idioms"},
+		indexedBook{Title: "Sale", Blurb: "50% off"},
+	)
+
+	if got := searched(t, db, "go"); got != "[Go in practice Go generics]" {
+		t.Errorf("expected the books matching in more fields first, got %v", got)
+	}
+	if got := searched(t, db, "go TYPES"); got != "[Go generics]" {
+		t.Errorf("expected every word to match, case insensitively, got %v", got)
+	}
+	if got := searched(t, db, "0%"); got != "[Sale]" {
+		t.Errorf("expected wildcards to match literally, got %v", got)
+	}
+
+	page, err := Search[indexedBook](ctx, db, "go", Pagination{Limit: 1, Page: 2, Sort: "title"}, map[string]interface{}{})
+	if err != nil || page.Total != 2 || len(page.Rows) != 1 || page.Rows[0].Title != "Go generics" {
+		t.Errorf("expected the ranked search to be paged, got %+v %v", page, err)
+	}
+}
+
+func TestSearchSQLite(t *testing.T) {
+	SetSearchableFields[indexedBook]("title")
+	SetSQLiteSearch[indexedBook]("book_search")
+	t.Cleanup(func() {
+		SetSearchableFields[indexedBook]()
+		updateModelSettings[indexedBook](func(s *modelSettings) { s.searchEngine, s.searchIndex = SearchLike, "" })
+	})
+	db := openBooks(t, indexedBook{Title: "go go go"}, indexedBook{Title: "rust"}, indexedBook{Title: "going places"}, indexedBook{Title: "cargo"})
+
+	// without the fts5 table the search falls back to like, which matches
+	// inside words
+	if got := searched(t, db, "go"); got != "[cargo go go go going places]" {
+		t.Errorf("expected the like search, got %v", got)
+	}
+
+	err := db.Exec("CREATE VIRTUAL TABLE book_search USING fts5(title, content='indexed_books', content_rowid='id')").Error
+	if err != nil && strings.Contains(err.Error(), "fts5") {
+		t.Skip("sqlite is built without fts5, run with -tags sqlite_fts5")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO book_search(book_search) VALUES ('rebuild')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := searched(t, db, "go"); got != "[go go go going places]" {
+		t.Errorf("expected prefixes to match, best rank first, got %v", got)
+	}
+	if got := searched(t, db, `"OR rust`); got != "[]" {
+		t.Errorf("expected the search not to be read as fts5 syntax, got %v", got)
+	}
+}
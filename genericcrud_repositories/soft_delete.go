@@ -0,0 +1,97 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deletedAtColumn is the gorm.DeletedAt column of T, the column gorm's soft
+// delete fills in.
+func deletedAtColumn[T any](databaseInstance *gorm.DB) (string, error) {
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return "", err
+	}
+	for _, field := range sch.Fields {
+		if field.DBName != "" && field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			return field.DBName, nil
+		}
+	}
+	return "", fmt.Errorf("%v has no gorm.DeletedAt field and cannot be soft deleted", modelType[T]().Name())
+}
+
+// softDeleted selects the soft deleted rows of T.
+func softDeleted[T any](databaseInstance *gorm.DB) (*gorm.DB, string, error) {
+	column, err := deletedAtColumn[T](databaseInstance)
+	if err != nil {
+		return nil, "", err
+	}
+	condition := clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{clause.Column{Table: clause.CurrentTable, Name: column}}}
+	return databaseInstance.Unscoped().Model(new(T)).Where(condition), column, nil
+}
+
+// RestoreById brings back the soft deleted row of T with the given id by
+// clearing its deleted_at column, and returns the restored row. The restore
+// hooks of T run around the write.
+func RestoreById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (T, error) {
+	return withHooks[T](ctx, databaseInstance, AuditRestore, func(ctx context.Context, tx *gorm.DB) (*T, *T, error) {
+		old, err := GetOneSoftDeletedById[T](ctx, tx, id)
+		return &old, nil, err
+	}, func(ctx context.Context, tx *gorm.DB) (T, *T, error) {
+		restored, err := restoreById[T](ctx, tx, id)
+		return restored, &restored, err
+	})
+}
+
+func restoreById[T any](ctx context.Context, databaseInstance *gorm.DB, id string) (T, error) {
+	log.Println(fmt.Sprintf("\n\nrestoring a row of: %v by id: %v", reflect.TypeOf(*new(T)).Name(), id))
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return *new(T), err
+	}
+
+	query, column, err := softDeleted[T](databaseInstance)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to restore: %v", err))
+		return *new(T), err
+	}
+
+	condition, err := byId[T](ctx, id)
+	if err != nil {
+		return *new(T), err
+	}
+
+	result := query.Where(condition).Update(column, nil)
+	if result.Error != nil {
+		log.Println(fmt.Sprintf("failed to restore row by id: %v %v", id, result.Error))
+		return *new(T), translateError[T](ctx, databaseInstance, result.Error)
+	}
+	if result.RowsAffected <= 0 {
+		log.Println(fmt.Sprintf("not restored: no soft deleted record found with id: %v", id))
+		return *new(T), notFound[T](id)
+	}
+
+	return getOneById[T](ctx, databaseInstance, id)
+}
+
+// GetAllSoftDeleted pages through the soft deleted rows of T, the trash. It
+// sorts, filters and paginates like GetAll.
+func GetAllSoftDeleted[T any](ctx context.Context, databaseInstance *gorm.DB, pagination Pagination, preloads ...string) (Page[T], error) {
+	log.Println(fmt.Sprintf("\n\nretreiving soft deleted collection: %v", reflect.TypeOf(*new(T)).Name()))
+	databaseInstance, err := scoped[T](ctx, databaseInstance)
+	if err != nil {
+		return newPage([]T{}, 0, pagination), err
+	}
+
+	query, _, err := softDeleted[T](databaseInstance)
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to retrieve soft deleted rows: %v", err))
+		return newPage([]T{}, 0, pagination), err
+	}
+	return findPage[T](ctx, query, pagination, preloads...)
+}
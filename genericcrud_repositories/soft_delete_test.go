@@ -0,0 +1,51 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type archivedNote struct {
+	Id        uint           `gorm:"primaryKey" json:"id"`
+	Title     string         `json:"title"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+func TestRestoreById(t *testing.T) {
+	SetSortableFields[archivedNote]("title")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&archivedNote{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&[]archivedNote{{Title: "a"}, {Title: "b"}, {Title: "c"}})
+	for _, id := range []string{"1", "3"} {
+		if _, err := DeleteSoftById[archivedNote](ctx, db, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trash, err := GetAllSoftDeleted[archivedNote](ctx, db, Pagination{Limit: 1, Sort: "title"})
+	if err != nil || trash.Total != 2 || len(trash.Rows) != 1 || trash.Rows[0].Title != "a" || !trash.Rows[0].DeletedAt.Valid {
+		t.Errorf("expected the first page of the trash, got %+v %v", trash, err)
+	}
+
+	restored, err := RestoreById[archivedNote](ctx, db, "1")
+	if err != nil || restored.Title != "a" || restored.DeletedAt.Valid {
+		t.Fatalf("unexpected restore: %+v %v", restored, err)
+	}
+	if row, err := GetOneById[archivedNote](ctx, db, "1"); err != nil || row.Title != "a" {
+		t.Errorf("expected the restored row to be found, got %+v %v", row, err)
+	}
+	if trash, err := GetAllSoftDeleted[archivedNote](ctx, db, Pagination{}); err != nil || trash.Total != 1 || trash.Rows[0].Title != "c" {
+		t.Errorf("expected c alone in the trash, got %+v %v", trash, err)
+	}
+
+	if _, err := RestoreById[archivedNote](ctx, db, "2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a live row not to be restored, got %v", err)
+	}
+	if _, err := RestoreById[archivedNote](ctx, db, "9"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a missing row not to be restored, got %v", err)
+	}
+}
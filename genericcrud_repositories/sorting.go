@@ -0,0 +1,88 @@
+package genericcrud_repositories_gorm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SortField is a single key of a sort expression such as "-createdAt,name".
+type SortField struct {
+	Field  string `json:"field"`
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+// ParseSort splits a comma separated sort expression into its keys. A leading
+// "-" sorts descending and a leading "+" ascending. Every key must have been
+// registered with SetSortableFields for T.
+func ParseSort[T any](sort string) ([]SortField, error) {
+	var fields []SortField
+	if strings.TrimSpace(sort) == "" {
+		return fields, nil
+	}
+
+	allowed := getModelSettings[T]().sortableFields
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		desc := false
+		switch {
+		case strings.HasPrefix(key, "-"):
+			desc = true
+			key = key[1:]
+		case strings.HasPrefix(key, "+"):
+			key = key[1:]
+		}
+
+		if key == "" {
+			return nil, withKind(ErrValidation, fmt.Errorf("invalid sort expression: %q", sort))
+		}
+
+		field := utils.ToCamelCaseLower(key)
+		if !allowed[field] {
+			return nil, withKind(ErrValidation, fmt.Errorf("cannot sort %v by: %v", modelType[T]().Name(), key))
+		}
+
+		fields = append(fields, SortField{
+			Field:  field,
+			Column: utils.ToSnakeCase(field),
+			Desc:   desc,
+		})
+	}
+	return fields, nil
+}
+
+// sortHandler orders the query by the keys of sort, after the expressions of
+// first, e.g. the relevance of a search, when there are any.
+func sortHandler[T any](databaseInstance *gorm.DB, sort string, first ...clause.Expression) (*gorm.DB, error) {
+	fields, err := ParseSort[T](sort)
+	if err != nil {
+		return databaseInstance, err
+	}
+
+	if len(first) > 0 {
+		// gorm drops the expression of an ORDER BY once columns are merged into
+		// it, so the keys are written in the same expression
+		expressions := append([]clause.Expression{}, first...)
+		for _, f := range fields {
+			column := clause.Expr{SQL: "?", Vars: []interface{}{clause.Column{Name: f.Column}}}
+			if f.Desc {
+				column.SQL += " DESC"
+			}
+			expressions = append(expressions, column)
+		}
+		return databaseInstance.Clauses(clause.OrderBy{Expression: clause.CommaExpression{Exprs: expressions}}), nil
+	}
+
+	instance := databaseInstance
+	for _, f := range fields {
+		instance = instance.Order(clause.OrderByColumn{
+			Column: clause.Column{Name: f.Column},
+			Desc:   f.Desc,
+		})
+	}
+	return instance, nil
+}
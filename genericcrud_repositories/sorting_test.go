@@ -0,0 +1,39 @@
+package genericcrud_repositories_gorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+type sortedModel struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func TestParseSort(t *testing.T) {
+	SetSortableFields[sortedModel]("name", "createdAt")
+
+	fields, err := ParseSort[sortedModel]("-createdAt, +name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SortField{
+		{Field: "createdAt", Column: "created_at", Desc: true},
+		{Field: "name", Column: "name"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got %+v, want %+v", fields, want)
+	}
+}
+
+func TestParseSortRejectsUnknownFields(t *testing.T) {
+	SetSortableFields[sortedModel]("name")
+
+	for _, sort := range []string{"id", "name;drop table x", "-", "name,,id"} {
+		if _, err := ParseSort[sortedModel](sort); err == nil {
+			t.Errorf("expected %q to be rejected", sort)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoTenant is returned by every operation on a model scoped by tenant when
+// the context carries no tenant.
+var ErrNoTenant = withKind(ErrForbidden, errors.New("no tenant in context"))
+
+// SetTenantColumn scopes T by tenant: every read, update, patch and delete of
+// T only sees the rows whose column holds the tenant of the context, creates
+// stamp it on the rows, and the column cannot be changed. Rows of other
+// tenants are reported as not found. Operations without a tenant in their
+// context fail with ErrNoTenant.
+func SetTenantColumn[T any](column string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.tenantColumn = utils.ToSnakeCase(column)
+	})
+}
+
+func tenantColumn[T any](ctx context.Context) string {
+	return settingsOf[T](ctx).tenantColumn
+}
+
+func isTenantColumn[T any](ctx context.Context, column string) bool {
+	tenant := tenantColumn[T](ctx)
+	return tenant != "" && utils.ToSnakeCase(column) == tenant
+}
+
+type tenantKey struct{}
+
+// WithTenant scopes the operations done within ctx to tenant, e.g. the client
+// id of the authenticated user.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func Tenant(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// tenantValue returns the tenant of ctx converted to the type of the tenant
+// field of T, and false when T is not scoped by tenant.
+func tenantValue[T any](ctx context.Context) (interface{}, bool, error) {
+	column := tenantColumn[T](ctx)
+	if column == "" {
+		return nil, false, nil
+	}
+
+	tenant, ok := Tenant(ctx)
+	if !ok || tenant == "" {
+		return nil, true, fmt.Errorf("%w: %v is scoped by %v", ErrNoTenant, modelType[T]().Name(), column)
+	}
+
+	index, ok := structField(modelType[T](), column)
+	if !ok {
+		return nil, true, fmt.Errorf("%v has no tenant field: %v", modelType[T]().Name(), column)
+	}
+	value, err := convertValue(modelType[T]().FieldByIndex(index).Type, tenant)
+	if err != nil {
+		return nil, true, withKind(ErrForbidden, fmt.Errorf("invalid tenant: %v", tenant))
+	}
+	return value, true, nil
+}
+
+// scoped is the connection of ctx restricted to the rows of T of the tenant of
+// ctx. Like connection, it can be used for several statements.
+func scoped[T any](ctx context.Context, databaseInstance *gorm.DB) (*gorm.DB, error) {
+	databaseInstance = connection(ctx, databaseInstance)
+
+	tenant, ok, err := tenantValue[T](ctx)
+	if err != nil || !ok {
+		return databaseInstance, err
+	}
+
+	condition := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: tenantColumn[T](ctx)}, Value: tenant}
+	return databaseInstance.Where(condition).Session(&gorm.Session{}), nil
+}
+
+// stampTenant sets the tenant field of rows to the tenant of ctx, whatever it
+// was set to.
+func stampTenant[T any](ctx context.Context, rows ...*T) error {
+	tenant, ok, err := tenantValue[T](ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	index, _ := structField(modelType[T](), tenantColumn[T](ctx))
+	for _, row := range rows {
+		if err := setValue(reflect.ValueOf(row).Elem().FieldByIndex(index), tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
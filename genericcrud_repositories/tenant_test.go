@@ -0,0 +1,52 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"testing"
+)
+
+type tenantModel struct {
+	Id       int    `json:"id"`
+	ClientId string `json:"clientId"`
+	Name     string `json:"name"`
+}
+
+func TestMemoryRepositoryTenantScoping(t *testing.T) {
+	r := NewMemoryRepository[tenantModel](WithTenantColumn("clientId"))
+	acme, globex := WithTenant(ctx, "acme"), WithTenant(ctx, "globex")
+
+	if _, err := r.Create(ctx, tenantModel{Name: "x"}); !errors.Is(err, ErrNoTenant) || !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected a create without tenant to be refused, got %v", err)
+	}
+
+	created, err := r.Create(acme, tenantModel{ClientId: "globex", Name: "a"})
+	if err != nil || created.ClientId != "acme" {
+		t.Fatalf("expected the tenant of the context to be stamped: %+v %v", created, err)
+	}
+	_, _ = r.Create(globex, tenantModel{Name: "b"})
+
+	if page, _ := r.GetAll(acme, Pagination{}); page.Total != 1 || page.Rows[0].Name != "a" {
+		t.Errorf("unexpected rows of acme: %+v", page)
+	}
+	if page, _ := r.GetAllByFields(globex, Pagination{}, map[string]interface{}{"client_id": "acme"}); page.Total != 0 {
+		t.Errorf("expected the query map not to widen the tenant: %+v", page)
+	}
+
+	if _, err := r.GetOneById(globex, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another tenant's row to be not found, got %v", err)
+	}
+	if _, err := r.PatchById(globex, "1", "name", "z"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected patching another tenant's row to be not found, got %v", err)
+	}
+	if _, err := r.DeletePermanentById(globex, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleting another tenant's row to be not found, got %v", err)
+	}
+
+	updated, err := r.UpdateById(acme, tenantModel{ClientId: "globex", Name: "c"}, "1")
+	if err != nil || updated.ClientId != "acme" || updated.Name != "c" {
+		t.Errorf("expected the tenant to be kept on update: %+v %v", updated, err)
+	}
+	if _, err := r.PatchById(acme, "1", "clientId", "globex"); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected patching the tenant to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type transactionKey struct{}
+
+// WithTransaction runs fn as a unit of work. Everything fn does through tx, or
+// through the functions of this package with a context derived from
+// tx.Statement.Context, commits together; the transaction is rolled back when
+// fn returns an error or panics.
+//
+// Calls nested inside a transaction, whether through ctx or by passing tx as
+// databaseInstance, run in a savepoint of the outer transaction: their
+// failure only undoes their own work, and nothing is committed until the
+// outermost call returns. The cache entries their writes invalidate are
+// dropped once the outermost call commits. A transaction begun some other
+// way, e.g. with gorm's Transaction, cannot tell when it commits: writes
+// within it invalidate the cache right away.
+func WithTransaction(ctx context.Context, databaseInstance *gorm.DB, fn func(tx *gorm.DB) error) error {
+	ctx = transactionContext(ctx, databaseInstance)
+	pending, nested := ctx.Value(afterCommitKey{}).(*afterCommit)
+	if !nested {
+		pending = &afterCommit{}
+		ctx = context.WithValue(ctx, afterCommitKey{}, pending)
+	}
+
+	err := connection(ctx, databaseInstance).Transaction(func(tx *gorm.DB) error {
+		return fn(tx.WithContext(context.WithValue(ctx, transactionKey{}, tx)))
+	})
+	if err == nil && !nested {
+		pending.run()
+	}
+	return err
+}
+
+type afterCommitKey struct{}
+
+// afterCommit holds the functions to run once the outermost transaction
+// commits.
+type afterCommit struct {
+	mu        sync.Mutex
+	fns       []func()
+	committed bool
+}
+
+func (a *afterCommit) run() {
+	a.mu.Lock()
+	fns := a.fns
+	a.fns, a.committed = nil, true
+	a.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// onCommit runs fn once the transaction of ctx commits, or right away outside
+// of a transaction. fn is not run when the transaction is rolled back.
+func onCommit(ctx context.Context, fn func()) {
+	if pending, ok := ctx.Value(afterCommitKey{}).(*afterCommit); ok {
+		if _, ok := TransactionFromContext(ctx); ok {
+			pending.mu.Lock()
+			if !pending.committed {
+				pending.fns = append(pending.fns, fn)
+				pending.mu.Unlock()
+				return
+			}
+			pending.mu.Unlock()
+		}
+	}
+	fn()
+}
+
+// TransactionFromContext returns the transaction ctx was derived from, if any.
+func TransactionFromContext(ctx context.Context) (*gorm.DB, bool) {
+	tx, ok := ctx.Value(transactionKey{}).(*gorm.DB)
+	return tx, ok
+}
+
+// inTransaction tells whether databaseInstance runs in a transaction.
+func inTransaction(databaseInstance *gorm.DB) bool {
+	if databaseInstance == nil || databaseInstance.Statement == nil {
+		return false
+	}
+	_, ok := databaseInstance.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// transactionContext makes the transaction databaseInstance runs in, if any,
+// the transaction of ctx, so that a tx passed with a context that does not
+// carry it still defers the work to do once it commits.
+func transactionContext(ctx context.Context, databaseInstance *gorm.DB) context.Context {
+	if !inTransaction(databaseInstance) {
+		return ctx
+	}
+	if tx, ok := TransactionFromContext(ctx); ok && tx.Statement.ConnPool == databaseInstance.Statement.ConnPool {
+		return ctx
+	}
+	if txCtx := databaseInstance.Statement.Context; txCtx != nil {
+		if pending, ok := txCtx.Value(afterCommitKey{}).(*afterCommit); ok {
+			ctx = context.WithValue(ctx, afterCommitKey{}, pending)
+		}
+	}
+	return context.WithValue(ctx, transactionKey{}, databaseInstance)
+}
+
+// connection is the database instance an operation runs on: databaseInstance
+// when it runs in a transaction, the ambient transaction of ctx when there is
+// one, databaseInstance otherwise.
+func connection(ctx context.Context, databaseInstance *gorm.DB) *gorm.DB {
+	if inTransaction(databaseInstance) {
+		return databaseInstance.WithContext(ctx)
+	}
+	if tx, ok := TransactionFromContext(ctx); ok {
+		return tx.WithContext(ctx)
+	}
+	return databaseInstance.WithContext(ctx)
+}
@@ -0,0 +1,126 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type transferModel struct {
+	Id        uint   `gorm:"primaryKey" json:"id"`
+	Reference string `gorm:"uniqueIndex" json:"reference"`
+	Note      string `json:"note"`
+}
+
+func openTransfers(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&transferModel{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// references are the references of the stored transfers, in order.
+func references(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	var result []string
+	if err := db.Model(&transferModel{}).Order("reference").Pluck("reference", &result).Error; err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(result)
+}
+
+func TestWithTransaction(t *testing.T) {
+	db := openTransfers(t)
+	create := func(tx *gorm.DB, reference string) error {
+		_, err := Create[transferModel](tx.Statement.Context, &transferModel{Reference: reference}, tx)
+		return err
+	}
+
+	err := WithTransaction(ctx, db, func(tx *gorm.DB) error {
+		if err := create(tx, "a"); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || references(t, db) != "[]" {
+		t.Errorf("expected the transaction to roll back, got %v %v", err, references(t, db))
+	}
+
+	err = WithTransaction(ctx, db, func(tx *gorm.DB) error {
+		if err := create(tx, "b"); err != nil {
+			return err
+		}
+		// the failure of a nested call only undoes its savepoint
+		nested := WithTransaction(tx.Statement.Context, tx, func(tx *gorm.DB) error {
+			if err := create(tx, "c"); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		if nested == nil {
+			return errors.New("expected the nested call to fail")
+		}
+		return create(tx, "d")
+	})
+	if err != nil || references(t, db) != "[b d]" {
+		t.Errorf("expected only the savepoint to roll back, got %v %v", err, references(t, db))
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to propagate")
+			}
+		}()
+		_ = WithTransaction(ctx, db, func(tx *gorm.DB) error {
+			if err := create(tx, "e"); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if references(t, db) != "[b d]" {
+		t.Errorf("expected a panic to roll back, got %v", references(t, db))
+	}
+}
+
+func TestWithTransactionDefersInvalidation(t *testing.T) {
+	cache := NewLRUCache(10)
+	SetCache[transferModel](cache, time.Minute)
+	t.Cleanup(func() { SetCache[transferModel](nil, 0) })
+	db := openTransfers(t)
+	db.Create(&transferModel{Reference: "a"})
+	generation := func() string {
+		value, _, _ := cache.Get(ctx, cachePrefix[transferModel]()+":generation")
+		return string(value)
+	}
+
+	if _, err := GetOneById[transferModel](ctx, db, "1"); err != nil {
+		t.Fatal(err)
+	}
+	before := generation()
+	err := WithTransaction(ctx, db, func(tx *gorm.DB) error {
+		// tx passed with a context that does not carry it
+		if _, err := PatchById[transferModel](ctx, tx, "1", "note", "x"); err != nil {
+			return err
+		}
+		if generation() != before {
+			return errors.New("expected the cache to be invalidated only once committed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generation() == before {
+		t.Error("expected the commit to invalidate the cache")
+	}
+	if row, err := GetOneById[transferModel](ctx, db, "1"); err != nil || row.Note != "x" {
+		t.Errorf("expected the committed row, got %+v %v", row, err)
+	}
+}
@@ -0,0 +1,271 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// conflictCondition selects the stored row that has the same values as model
+// in the conflict columns.
+func conflictCondition[T any](databaseInstance *gorm.DB, model *T, conflictColumns []string) (map[string]interface{}, error) {
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	condition := map[string]interface{}{}
+	for _, c := range conflictColumns {
+		field := sch.LookUpField(utils.ToSnakeCase(c))
+		if field == nil {
+			return nil, fmt.Errorf("%v has no column: %v", sch.Name, c)
+		}
+		value, _ := field.ValueOf(databaseInstance.Statement.Context, reflect.ValueOf(model).Elem())
+		condition[field.DBName] = value
+	}
+	return condition, nil
+}
+
+// updateColumnsOf are the columns to write to the row a model conflicts with:
+// the updateColumns, or every updatable column but the primary key, the
+// conflict columns, the creation time and the soft delete column. The tenant
+// and the version columns are never among them.
+func updateColumnsOf[T any](ctx context.Context, databaseInstance *gorm.DB, conflictColumns, updateColumns []string) ([]string, error) {
+	sch, err := parseSchema[T](databaseInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := map[string]bool{}
+	for _, c := range conflictColumns {
+		skipped[utils.ToSnakeCase(c)] = true
+	}
+
+	var fields []*schema.Field
+	if len(updateColumns) > 0 {
+		for _, c := range updateColumns {
+			field := sch.LookUpField(utils.ToSnakeCase(c))
+			if field == nil || field.DBName == "" {
+				return nil, withKind(ErrValidation, fmt.Errorf("%v has no column: %v", sch.Name, c))
+			}
+			fields = append(fields, field)
+		}
+	} else {
+		for _, field := range sch.Fields {
+			if field.DBName == "" || field.PrimaryKey || !field.Updatable || field.AutoCreateTime > 0 || skipped[field.DBName] ||
+				field.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+				continue
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	var columns []string
+	for _, field := range fields {
+		if isTenantColumn[T](ctx, field.DBName) || field.DBName == versionColumn[T]() {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns, nil
+}
+
+// onConflict is the clause that turns the insert of T into an update of the
+// row in conflict: it writes the columns of the incoming row, increments the
+// version, and leaves alone the rows of other tenants and soft deleted rows.
+func onConflict[T any](ctx context.Context, databaseInstance *gorm.DB, conflictColumns, updateColumns []string) (clause.OnConflict, error) {
+	conflict := clause.OnConflict{}
+	for _, c := range conflictColumns {
+		conflict.Columns = append(conflict.Columns, clause.Column{Name: utils.ToSnakeCase(c)})
+	}
+
+	columns, err := updateColumnsOf[T](ctx, databaseInstance, conflictColumns, updateColumns)
+	if err != nil {
+		return conflict, err
+	}
+	conflict.DoUpdates = clause.AssignmentColumns(columns)
+	if column := versionColumn[T](); column != "" {
+		conflict.DoUpdates = append(conflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value:  gorm.Expr("? + 1", clause.Column{Table: clause.CurrentTable, Name: column}),
+		})
+	}
+
+	tenant, ok, err := tenantValue[T](ctx)
+	if err != nil {
+		return conflict, err
+	}
+	if ok {
+		conflict.Where.Exprs = append(conflict.Where.Exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: tenantColumn[T](ctx)}, Value: tenant})
+	}
+	if column, err := deletedAtColumn[T](databaseInstance); err == nil {
+		conflict.Where.Exprs = append(conflict.Where.Exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: nil})
+	}
+	// there is nothing to write to the row in conflict
+	if len(conflict.DoUpdates) == 0 {
+		conflict.DoNothing, conflict.Where = true, clause.Where{}
+	}
+	return conflict, nil
+}
+
+// stored reads, and locks where the database can, the row each of models is
+// in conflict with. It fails with ErrConflict when that row belongs to another
+// tenant or is soft deleted, and with a VersionConflictError when it is not at
+// the expected version.
+func stored[T any](ctx context.Context, tx *gorm.DB, models []T, conditions []map[string]interface{}) ([]bool, error) {
+	scopedTx, err := scoped[T](ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make([]bool, len(models))
+	for i := range models {
+		var rows []T
+		found := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where(conditions[i]).Limit(1).Find(&rows)
+		if found.Error != nil {
+			return nil, found.Error
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		exists[i] = true
+
+		var visible []T
+		if err := scopedTx.Where(conditions[i]).Limit(1).Find(&visible).Error; err != nil {
+			return nil, err
+		}
+		if len(visible) == 0 {
+			return nil, withKind(ErrConflict, fmt.Errorf("%v conflicts with a row that cannot be updated", reflect.TypeOf(*new(T)).Name()))
+		}
+		if _, _, err := checkVersion[T](ctx, visible[0], &models[i]); err != nil {
+			return nil, err
+		}
+	}
+	return exists, nil
+}
+
+// upsert writes models within the transaction tx in a single INSERT ... ON
+// CONFLICT DO UPDATE statement and reads the stored rows back.
+//
+// Whether a row was inserted is told on PostgreSQL by the system column xmax
+// of the written row. Elsewhere it is told by the rows read, and locked, before
+// the write: two concurrent upserts of the same new row may then both report
+// an insert.
+func upsert[T any](ctx context.Context, tx *gorm.DB, models []T, conflictColumns, updateColumns []string) ([]T, []bool, error) {
+	for i := range models {
+		if err := stampTenant[T](ctx, &models[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conditions := make([]map[string]interface{}, len(models))
+	for i := range models {
+		condition, err := conflictCondition(tx, &models[i], conflictColumns)
+		if err != nil {
+			return nil, nil, err
+		}
+		conditions[i] = condition
+	}
+
+	exists, err := stored[T](ctx, tx, models, conditions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conflict, err := onConflict[T](ctx, tx, conflictColumns, updateColumns)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Clauses(conflict).Create(&models).Error; err != nil {
+		return nil, nil, translateError[T](ctx, tx, err)
+	}
+
+	scopedTx, err := scoped[T](ctx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows := make([]T, len(models))
+	inserted := make([]bool, len(models))
+	for i := range models {
+		found := scopedTx.Where(conditions[i]).Limit(1).Find(&rows[i])
+		if found.Error != nil {
+			return nil, nil, found.Error
+		}
+		// the row in conflict was not updated: MySQL ignores the conditions of
+		// the clause and a concurrent upsert may have taken the row meanwhile
+		if found.RowsAffected == 0 {
+			return nil, nil, withKind(ErrConflict, fmt.Errorf("%v conflicts with a row that cannot be updated", reflect.TypeOf(*new(T)).Name()))
+		}
+
+		inserted[i] = !exists[i]
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Model(new(T)).Select("xmax = 0").Where(conditions[i]).Scan(&inserted[i]).Error; err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return rows, inserted, nil
+}
+
+// Upsert inserts model, or updates the updateColumns of the row that already
+// has the same values in conflictColumns; without updateColumns every column
+// but the primary key and the conflict columns is updated, and the version of
+// a versioned T is incremented. It returns the stored row and whether it was
+// inserted. A row of another tenant, or a soft deleted one, in conflict with
+// model is not updated and fails the upsert with ErrConflict; a row at another
+// version than the expected one fails it with a VersionConflictError.
+func Upsert[T any](ctx context.Context, databaseInstance *gorm.DB, model *T, conflictColumns []string, updateColumns ...string) (T, bool, error) {
+	log.Println(fmt.Sprintf("\n\nupserting a record: %v on: %v", reflect.TypeOf(*new(T)).Name(), conflictColumns))
+	ctx = transactionContext(ctx, databaseInstance)
+	defer invalidate[T](ctx)
+	var row T
+	inserted := false
+
+	err := WithTransaction(ctx, databaseInstance, func(tx *gorm.DB) error {
+		rows, inserts, err := upsert[T](tx.Statement.Context, tx, []T{*model}, conflictColumns, updateColumns)
+		if err != nil {
+			return err
+		}
+		row, inserted = rows[0], inserts[0]
+		return nil
+	})
+
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to upsert: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return row, false, err
+	}
+
+	log.Println(fmt.Sprintf("upserted: inserted: %v", inserted))
+	return row, inserted, nil
+}
+
+// UpsertBatch upserts every model like Upsert in a single statement: when one
+// of them fails none is written. It returns the stored rows and whether each
+// of them was inserted.
+func UpsertBatch[T any](ctx context.Context, databaseInstance *gorm.DB, models []T, conflictColumns []string, updateColumns ...string) ([]T, []bool, error) {
+	log.Println(fmt.Sprintf("\n\nupserting records: %v on: %v", reflect.TypeOf(*new(T)).Name(), conflictColumns))
+	ctx = transactionContext(ctx, databaseInstance)
+	defer invalidate[T](ctx)
+	var rows []T
+	var inserted []bool
+
+	err := WithTransaction(ctx, databaseInstance, func(tx *gorm.DB) error {
+		var err error
+		rows, inserted, err = upsert[T](tx.Statement.Context, tx, models, conflictColumns, updateColumns)
+		return err
+	})
+
+	if err != nil {
+		log.Println(fmt.Sprintf("failed to upsert in batch: %v %v", reflect.TypeOf(*new(T)).Name(), err))
+		return models, nil, err
+	}
+
+	log.Println(fmt.Sprintf("upserted: rows: %v", len(rows)))
+	return rows, inserted, nil
+}
@@ -0,0 +1,89 @@
+package genericcrud_repositories_gorm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type upsertedStock struct {
+	Id        uint           `gorm:"primaryKey" json:"id"`
+	Sku       string         `gorm:"uniqueIndex" json:"sku"`
+	Quantity  int            `json:"quantity"`
+	Note      string         `json:"note"`
+	Version   int64          `json:"version"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt"`
+}
+
+func openStock(t *testing.T) *gorm.DB {
+	t.Helper()
+	SetVersionField[upsertedStock]("version")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&upsertedStock{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestUpsertIncrementsVersion(t *testing.T) {
+	db := openStock(t)
+
+	row, inserted, err := Upsert[upsertedStock](ctx, db, &upsertedStock{Sku: "a", Quantity: 1, Note: "first"}, []string{"sku"})
+	if err != nil || !inserted || row.Id != 1 || row.Version != 0 {
+		t.Fatalf("expected a to be inserted, got %+v %v %v", row, inserted, err)
+	}
+
+	// a body at another version is stale, and the version is never written
+	// from the body but incremented
+	row, _, err = Upsert[upsertedStock](ctx, db, &upsertedStock{Sku: "a", Quantity: 2, Note: "second", Version: 40}, []string{"sku"}, "quantity", "version")
+	if err == nil {
+		t.Errorf("expected the stale version of the body to be refused, got %+v", row)
+	}
+	row, inserted, err = Upsert[upsertedStock](ctx, db, &upsertedStock{Sku: "a", Quantity: 2, Note: "second"}, []string{"sku"}, "quantity", "version")
+	if err != nil || inserted || row.Quantity != 2 || row.Note != "first" || row.Version != 1 {
+		t.Errorf("expected only the quantity of a to be updated at version 1, got %+v %v %v", row, inserted, err)
+	}
+}
+
+func TestUpsertHonoursExpectedVersion(t *testing.T) {
+	db := openStock(t)
+	if _, _, err := Upsert[upsertedStock](ctx, db, &upsertedStock{Sku: "a"}, []string{"sku"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := Upsert[upsertedStock](WithExpectedVersion(ctx, 3), db, &upsertedStock{Sku: "a", Quantity: 5}, []string{"sku"})
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || !conflict.Precondition || conflict.Expected != 3 || conflict.Actual != 0 {
+		t.Fatalf("expected a failed precondition at version 0, got %v", err)
+	}
+
+	row, _, err := Upsert[upsertedStock](WithExpectedVersion(ctx, 0), db, &upsertedStock{Sku: "a", Quantity: 5}, []string{"sku"})
+	if err != nil || row.Quantity != 5 || row.Version != 1 {
+		t.Errorf("expected the update at version 0 to apply, got %+v %v", row, err)
+	}
+}
+
+func TestUpsertBatch(t *testing.T) {
+	db := openStock(t)
+	if _, _, err := Upsert[upsertedStock](ctx, db, &upsertedStock{Sku: "a", Quantity: 1}, []string{"sku"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, inserted, err := UpsertBatch[upsertedStock](ctx, db, []upsertedStock{{Sku: "a", Quantity: 2}, {Sku: "b", Quantity: 3}}, []string{"sku"})
+	if err != nil || fmt.Sprint(inserted) != "[false true]" || rows[0].Quantity != 2 || rows[0].Version != 1 || rows[1].Sku != "b" {
+		t.Fatalf("unexpected batch: %+v %v %v", rows, inserted, err)
+	}
+
+	if _, err := DeleteSoftById[upsertedStock](ctx, db, "1"); err != nil {
+		t.Fatal(err)
+	}
+	// the soft deleted row still holds its sku and fails the batch as a whole
+	_, _, err = UpsertBatch[upsertedStock](ctx, db, []upsertedStock{{Sku: "c"}, {Sku: "a", Quantity: 9}}, []string{"sku"})
+	var count int64
+	db.Unscoped().Model(&upsertedStock{}).Count(&count)
+	if !errors.Is(err, ErrConflict) || count != 2 {
+		t.Errorf("expected the batch to fail as a whole, got %v and %v rows", err, count)
+	}
+}
@@ -0,0 +1,139 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/danielcomboni/generic-crud/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrVersionConflict = withKind(ErrConflict, errors.New("version conflict"))
+
+// VersionConflictError is returned when a row was changed since the version
+// the caller based its update on. Precondition is set when the expected
+// version was given through WithExpectedVersion, i.e. an If-Match header.
+// Actual is -1 when the row was deleted concurrently.
+type VersionConflictError struct {
+	Expected     int64
+	Actual       int64
+	Precondition bool
+}
+
+func (e *VersionConflictError) Error() string {
+	if e.Actual < 0 {
+		return fmt.Sprintf("version conflict: version %v was deleted concurrently", e.Expected)
+	}
+	return fmt.Sprintf("version conflict: expected version %v, found %v", e.Expected, e.Actual)
+}
+
+// Is matches ErrVersionConflict, and ErrPreconditionFailed or ErrConflict
+// depending on whether the expected version came from a precondition.
+func (e *VersionConflictError) Is(target error) bool {
+	if e.Precondition {
+		return target == ErrVersionConflict || target == ErrPreconditionFailed
+	}
+	return target == ErrVersionConflict || target == ErrConflict
+}
+
+// SetVersionField registers the integer json field of T that holds its version.
+// Updates and patches of T then only apply to the version they were based on
+// and increment it.
+func SetVersionField[T any](field string) {
+	updateModelSettings[T](func(s *modelSettings) {
+		s.versionField = field
+	})
+}
+
+func versionColumn[T any]() string {
+	if field := getModelSettings[T]().versionField; field != "" {
+		return utils.ToSnakeCase(field)
+	}
+	return ""
+}
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion makes updates and patches within ctx fail unless the
+// stored row is at version.
+func WithExpectedVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+func ExpectedVersion(ctx context.Context) (int64, bool) {
+	version, ok := ctx.Value(expectedVersionKey{}).(int64)
+	return version, ok
+}
+
+// VersionOf returns the version of row when T has a version field.
+func VersionOf[T any](row T) (int64, bool) {
+	column := versionColumn[T]()
+	if column == "" {
+		return 0, false
+	}
+
+	index, ok := structField(modelType[T](), column)
+	if !ok {
+		return 0, false
+	}
+
+	v := reflect.ValueOf(row).FieldByIndex(index)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+func setVersion[T any](row *T, version int64) {
+	index, ok := structField(modelType[T](), versionColumn[T]())
+	if !ok {
+		return
+	}
+
+	v := reflect.ValueOf(row).Elem().FieldByIndex(index)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(version)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(version))
+	}
+}
+
+// checkVersion compares the stored row with the version expected by ctx or,
+// failing that, by the incoming row. It returns the condition that keeps the
+// write from overwriting a concurrent change, or nil when T is not versioned.
+func checkVersion[T any](ctx context.Context, stored T, incoming *T) (clause.Expression, int64, error) {
+	current, ok := VersionOf(stored)
+	if !ok || !hasPrimaryKey(ctx, stored) {
+		return nil, 0, nil
+	}
+
+	expected, precondition := ExpectedVersion(ctx)
+	if !precondition && incoming != nil {
+		expected, _ = VersionOf(*incoming)
+	}
+
+	if (precondition || expected != 0) && expected != current {
+		return nil, current, &VersionConflictError{Expected: expected, Actual: current, Precondition: precondition}
+	}
+
+	return clause.Eq{Column: clause.Column{Name: versionColumn[T]()}, Value: current}, current, nil
+}
+
+// concurrentConflict is the error of a write guarded by the version current
+// that matched no row: the row was changed, or deleted, between the read and
+// the write. The version it is at now is read again.
+func concurrentConflict[T any](ctx context.Context, databaseInstance *gorm.DB, id string, current int64) error {
+	_, precondition := ExpectedVersion(ctx)
+	conflict := &VersionConflictError{Expected: current, Actual: -1, Precondition: precondition}
+	if row, err := getOneById[T](ctx, databaseInstance, id); err == nil {
+		conflict.Actual, _ = VersionOf(row)
+	}
+	return conflict
+}
@@ -0,0 +1,104 @@
+package genericcrud_repositories_gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type versionedModel struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+func TestVersionedUpdates(t *testing.T) {
+	SetVersionField[versionedModel]("version")
+	r := NewMemoryRepository[versionedModel]()
+	created, _ := r.Create(ctx, versionedModel{Name: "a", Version: 1})
+
+	updated, err := r.UpdateById(ctx, versionedModel{Name: "b", Version: 1}, created.Id)
+	if err != nil || updated.Version != 2 {
+		t.Fatalf("update: %+v %v", updated, err)
+	}
+
+	_, err = r.UpdateById(ctx, versionedModel{Name: "c", Version: 1}, created.Id)
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Precondition || conflict.Actual != 2 {
+		t.Fatalf("expected a version conflict, got %v", err)
+	}
+
+	_, err = r.PatchById(WithExpectedVersion(ctx, 1), created.Id, "name", "d")
+	if !errors.As(err, &conflict) || !conflict.Precondition || !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected a failed precondition, got %v", err)
+	}
+
+	patched, err := r.PatchById(WithExpectedVersion(ctx, 2), created.Id, "name", "d")
+	if err != nil || patched.Version != 3 || patched.Name != "d" {
+		t.Fatalf("patch: %+v %v", patched, err)
+	}
+
+	if version, ok := VersionOf(patched); !ok || version != 3 {
+		t.Errorf("unexpected version: %v %v", version, ok)
+	}
+}
+
+type racedModel struct {
+	Id      uint   `gorm:"primaryKey" json:"id"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+// raceUpdates bumps the version of the row of racedModel before every update
+// gorm runs, as a concurrent writer would between the read and the write.
+func raceUpdates(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	err := db.Callback().Update().Before("gorm:update").Register("test:race", func(tx *gorm.DB) {
+		if tx.Statement.Table == "raced_models" {
+			if _, err := tx.Statement.ConnPool.ExecContext(tx.Statement.Context, "UPDATE raced_models SET version = version + 1"); err != nil {
+				tx.AddError(err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentVersionConflicts(t *testing.T) {
+	SetVersionField[racedModel]("version")
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&racedModel{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&racedModel{Name: "a"})
+	raceUpdates(t, db)
+
+	writes := map[string]func(ctx context.Context) error{
+		"update": func(ctx context.Context) error {
+			_, err := UpdateById[racedModel](ctx, db, racedModel{Name: "b"}, "1")
+			return err
+		},
+		"patch": func(ctx context.Context) error {
+			_, err := PatchById[racedModel](ctx, db, "1", "name", "b")
+			return err
+		},
+		"merge patch": func(ctx context.Context) error {
+			_, err := MergePatchById[racedModel](ctx, db, "1", []byte(`{"name":"b"}`), func(interface{}) error { return nil })
+			return err
+		},
+	}
+	for name, write := range writes {
+		var current racedModel
+		db.First(&current)
+
+		err := write(WithExpectedVersion(ctx, current.Version))
+		var conflict *VersionConflictError
+		if !errors.As(err, &conflict) || !conflict.Precondition || !errors.Is(err, ErrPreconditionFailed) ||
+			conflict.Expected != current.Version || conflict.Actual != current.Version+1 {
+			t.Errorf("%v: expected a failed precondition at version %v, got %+v", name, current.Version+1, err)
+		}
+	}
+}
@@ -23,6 +23,40 @@ func SetResponse(status int, message string, data interface{}) GenericResponse {
 	}
 }
 
+// PageMeta describes where a page of results sits in the whole collection.
+// A negative Total means the collection was not counted.
+type PageMeta struct {
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	TotalPages int    `json:"totalPages"`
+	HasNext    bool   `json:"hasNext"`
+	HasPrev    bool   `json:"hasPrev"`
+	NextCursor string `json:"nextCursor"`
+	PrevCursor string `json:"prevCursor"`
+}
+
+// SetPaginatedResponse is SetResponse for list endpoints: the page metadata is
+// returned next to the result.
+func SetPaginatedResponse(status int, message string, data interface{}, meta PageMeta) GenericResponse {
+	response := SetResponse(status, message, data)
+	if meta.Total >= 0 {
+		response.Data["total"] = meta.Total
+		response.Data["page"] = meta.Page
+		response.Data["totalPages"] = meta.TotalPages
+	}
+	response.Data["limit"] = meta.Limit
+	response.Data["hasNext"] = meta.HasNext
+	response.Data["hasPrev"] = meta.HasPrev
+	if meta.NextCursor != "" {
+		response.Data["nextCursor"] = meta.NextCursor
+	}
+	if meta.PrevCursor != "" {
+		response.Data["prevCursor"] = meta.PrevCursor
+	}
+	return response
+}
+
 const BadRequest = http.StatusBadRequest
 const InternalServerError = http.StatusInternalServerError
 const Created = http.StatusCreated
@@ -30,3 +64,4 @@ const OK = http.StatusOK
 const NotFound = http.StatusNotFound
 const UnAuthorized = http.StatusUnauthorized
 const ConflictOrDuplicateOrAlreadyExists = http.StatusConflict
+const PreconditionFailed = http.StatusPreconditionFailed
@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrJSONPatchTestFailed is returned when a test operation of a JSON patch
+// does not match the document.
+var ErrJSONPatchTestFailed = errors.New("json patch test failed")
+
+// JSONPatchOperation is a single operation of an RFC 6902 JSON patch. Value is
+// kept raw so that an explicit null can be told apart from a missing value.
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyJSONPatch applies the operations of an RFC 6902 JSON patch to a json
+// document in order. The first failing operation fails the whole patch.
+func ApplyJSONPatch(document []byte, operations []JSONPatchOperation) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, err
+	}
+
+	for i, op := range operations {
+		var err error
+		if doc, err = applyJSONPatchOperation(doc, op); err != nil {
+			if errors.Is(err, ErrJSONPatchTestFailed) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("operation %v (%v %v): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func applyJSONPatchOperation(doc interface{}, op JSONPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if op.Value == nil {
+			return nil, fmt.Errorf("%v operation needs a value", op.Op)
+		}
+		var v interface{}
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add", "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return setJSONValue(doc, path, v, op.Op == "add")
+	case "remove":
+		doc, _, err = removeJSONValue(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := getJSONValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, errors.New("a value cannot be moved into one of its children")
+			}
+			if doc, _, err = removeJSONValue(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			v = copyJSONValue(v)
+		}
+		return setJSONValue(doc, path, v, true)
+	case "test":
+		expected, err := value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := getJSONValue(doc, path)
+		if err != nil || !reflect.DeepEqual(actual, expected) {
+			return nil, fmt.Errorf("%w: %v", ErrJSONPatchTestFailed, op.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown json patch operation: %v", op.Op)
+}
+
+// parseJSONPointer splits an RFC 6901 JSON pointer into its unescaped tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer: %v", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index: %v", token)
+	}
+
+	max := length - 1
+	if appending {
+		max = length
+	}
+	if index > max {
+		return 0, fmt.Errorf("array index out of bounds: %v", token)
+	}
+	return index, nil
+}
+
+func getJSONValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("no such member: %v", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("no such member: %v", token)
+		}
+	}
+	return doc, nil
+}
+
+// setJSONValue adds (insert) or replaces the value at path and returns the
+// updated document.
+func setJSONValue(doc interface{}, path []string, value interface{}, insert bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if len(rest) == 0 {
+			if !ok && !insert {
+				return nil, fmt.Errorf("no such member: %v", token)
+			}
+			node[token] = value
+			return node, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("no such member: %v", token)
+		}
+		updated, err := setJSONValue(child, rest, value, insert)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+	case []interface{}:
+		if len(rest) == 0 && insert {
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			node[i] = value
+			return node, nil
+		}
+		updated, err := setJSONValue(node[i], rest, value, insert)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = updated
+		return node, nil
+	}
+	return nil, fmt.Errorf("no such member: %v", token)
+}
+
+// removeJSONValue removes the value at path and returns the updated document
+// and the removed value.
+func removeJSONValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("no such member: %v", token)
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+		updated, removed, err := removeJSONValue(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = updated
+		return node, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := node[i]
+			return append(node[:i], node[i+1:]...), removed, nil
+		}
+		updated, removed, err := removeJSONValue(node[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[i] = updated
+		return node, removed, nil
+	}
+	return nil, nil, fmt.Errorf("no such member: %v", token)
+}
+
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = copyJSONValue(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyJSONValue(e)
+		}
+		return c
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func applyJSONPatchString(t *testing.T, document, patch string) (string, error) {
+	var operations []JSONPatchOperation
+	if err := json.Unmarshal([]byte(patch), &operations); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ApplyJSONPatch([]byte(document), operations)
+	return string(result), err
+}
+
+// cases from RFC 6902, appendix A
+func TestApplyJSONPatch(t *testing.T) {
+	cases := []struct{ document, patch, want string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a/b","path":"/c"},{"op":"add","path":"/c/-","value":2}]`, `{"a":{"b":[1]},"c":[1,2]}`},
+	}
+
+	for _, c := range cases {
+		got, err := applyJSONPatchString(t, c.document, c.patch)
+		if err != nil {
+			t.Errorf("%v: %v", c.patch, err)
+			continue
+		}
+
+		var gotValue, wantValue interface{}
+		_ = json.Unmarshal([]byte(got), &gotValue)
+		_ = json.Unmarshal([]byte(c.want), &wantValue)
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("%v: got %v, want %v", c.patch, got, c.want)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	if _, err := applyJSONPatchString(t, `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`); !errors.Is(err, ErrJSONPatchTestFailed) {
+		t.Errorf("expected a failed test, got %v", err)
+	}
+
+	for _, patch := range []string{
+		`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"replace","path":"/missing","value":1}]`,
+		`[{"op":"add","path":"/list/5","value":1}]`,
+		`[{"op":"add","path":"/list/01","value":1}]`,
+		`[{"op":"add","path":"/x"}]`,
+		`[{"op":"move","from":"/obj","path":"/obj/child"}]`,
+		`[{"op":"frobnicate","path":"/x"}]`,
+	} {
+		_, err := applyJSONPatchString(t, `{"foo":"bar","list":[1],"obj":{}}`, patch)
+		if err == nil || errors.Is(err, ErrJSONPatchTestFailed) {
+			t.Errorf("%v: expected an error, got %v", patch, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/Jeffail/gabs"
 	"log"
@@ -33,3 +34,13 @@ func AlterDynamicProperty(prevDynamicValue []byte, dynamicProperty interface{})
 	log.Println("previous dynamic property is EMPTY")
 	return ConvertInterfaceToMapOfStringKey(dynamicProperty)
 }
+
+// DecodeJSONInto copies a decoded json value, such as a request body read into
+// a map, into target by encoding it back to json.
+func DecodeJSONInto(value interface{}, target interface{}) error {
+	marshal, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(marshal, target)
+}
@@ -0,0 +1,44 @@
+package utils
+
+import "encoding/json"
+
+// MergePatch applies an RFC 7396 JSON merge patch to a decoded json value:
+// objects are merged recursively, null removes a member and any other value
+// replaces the target.
+func MergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	merged := make(map[string]interface{}, len(targetObject))
+	for k, v := range targetObject {
+		merged[k] = v
+	}
+
+	for k, v := range patchObject {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = MergePatch(merged[k], v)
+	}
+	return merged
+}
+
+// ApplyMergePatch is MergePatch on encoded json documents.
+func ApplyMergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(MergePatch(target, p))
+}